@@ -0,0 +1,288 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const backupManifestName = "backup-manifest"
+
+// 增量备份清单，记录每个文件已经备份的大小
+type backupManifest struct {
+	SeqNo uint64                    `json:"seq_no"` // 备份时数据库的序列号
+	Files map[string]backupFileInfo `json:"files"`
+}
+
+type backupFileInfo struct {
+	Inode uint64 `json:"inode"` // merge之后同名文件会被替换，通过inode区分
+	Size  int64  `json:"size"`
+}
+
+// 增量备份，只拷贝上次备份之后新增的文件以及追加的数据
+// 只在持久化活跃文件、记录文件大小时持有锁，拷贝数据时不阻塞写操作
+func (db *DB) IncrementalBackUp(dir string) error {
+	// B+树索引文件会被原地修改，无法增量拷贝
+	if db.opt.IndexType == BPlusTree {
+		return ErrBackupUnsupported
+	}
+
+	if err := db.opt.FS.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	prev, err := readBackupManifest(db.opt.FS, dir)
+	if err != nil && err != ErrBackupNotFound {
+		return err
+	}
+
+	db.mu.Lock()
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			db.mu.Unlock()
+			return err
+		}
+	}
+	files, err := backupFiles(db.opt.FS, db.opt.DirPath)
+	seqNo := db.seqNo
+	// 活跃文件末尾可能有预分配的空间，以实际写入的位置为准
+	if err == nil && db.activeFile != nil {
+		name := filepath.Base(data.GetFileName(db.opt.DirPath, db.activeFile.FileID))
+		if info, ok := files[name]; ok {
+			info.Size = db.activeFile.WriteOff
+			files[name] = info
+		}
+	}
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 数据文件只会追加写，记录的大小之前的数据不会再改变
+	for name, info := range files {
+		src, dst := filepath.Join(db.opt.DirPath, name), filepath.Join(dir, name)
+		old, ok := prev.Files[name]
+		switch {
+		case ok && old.Inode == info.Inode && old.Size == info.Size:
+			continue
+		case ok && old.Inode == info.Inode && old.Size < info.Size:
+			err = fio.CopyFileRange(db.opt.FS, src, dst, old.Size, info.Size)
+		default:
+			err = fio.CopyFileRange(db.opt.FS, src, dst, 0, info.Size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// 删除merge之后已经不存在的文件
+	for name := range prev.Files {
+		if _, ok := files[name]; !ok {
+			if err := db.opt.FS.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+
+	return writeBackupManifest(db.opt.FS, dir, &backupManifest{SeqNo: seqNo, Files: files})
+}
+
+// 从增量备份中恢复数据到targetDir，只保留序列号不大于untilSeq的写入，untilSeq为0表示恢复全部数据
+// merge会丢弃旧版本，untilSeq早于备份中最近一次merge时返回ErrRestorePointMerged
+func Restore(backupDir, targetDir string, untilSeq uint64) error {
+	return RestoreFS(fio.OSFS{}, backupDir, targetDir, untilSeq)
+}
+
+// 与Restore相同，备份目录和目标目录都在fsys中
+func RestoreFS(fsys fio.FS, backupDir, targetDir string, untilSeq uint64) error {
+	manifest, err := readBackupManifest(fsys, backupDir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := fsys.ReadDir(targetDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return ErrTargetDirNotEmpty
+	}
+	if err := fsys.MkdirAll(targetDir); err != nil {
+		return err
+	}
+
+	for name, info := range manifest.Files {
+		src, dst := filepath.Join(backupDir, name), filepath.Join(targetDir, name)
+		if err := fio.CopyFileRange(fsys, src, dst, 0, info.Size); err != nil {
+			return err
+		}
+	}
+
+	if untilSeq == 0 {
+		return nil
+	}
+	return truncateToSeqNo(fsys, targetDir, untilSeq)
+}
+
+// 截断序列号大于seqNo的所有记录
+func truncateToSeqNo(fsys fio.FS, dirPath string, seqNo uint64) error {
+	// hint文件对应的数据已经merge，无法截断
+	var nonMergeFileId uint32
+	if _, err := fsys.Stat(filepath.Join(dirPath, data.MergeFinishedFileName)); err == nil {
+		if nonMergeFileId, err = getNonMergeFileID(fsys, dirPath); err != nil {
+			return err
+		}
+		maxSeqNo, err := maxHintSeqNo(fsys, dirPath)
+		if err != nil {
+			return err
+		}
+		if maxSeqNo > seqNo {
+			return ErrRestorePointMerged
+		}
+	}
+
+	fileIds, err := listDataFileIds(fsys, dirPath)
+	if err != nil {
+		return err
+	}
+
+	// 写入都在锁内分配序列号并追加，数据文件中的序列号是递增的
+	truncated := false
+	for _, fid := range fileIds {
+		fileName := data.GetFileName(dirPath, uint32(fid))
+		if truncated {
+			if err := fsys.Remove(fileName); err != nil {
+				return err
+			}
+			continue
+		}
+		if uint32(fid) < nonMergeFileId {
+			continue
+		}
+
+		offset, found, err := findSeqNoOffset(fsys, dirPath, uint32(fid), seqNo)
+		if err != nil {
+			return err
+		}
+		if found {
+			if err := fsys.Truncate(fileName, offset); err != nil {
+				return err
+			}
+			truncated = true
+		}
+	}
+
+	return nil
+}
+
+// 查找数据文件中第一条序列号大于seqNo的记录的位置
+func findSeqNoOffset(fsys fio.FS, dirPath string, fid uint32, seqNo uint64) (int64, bool, error) {
+	dataFile, err := data.OpenDataFile(fsys, dirPath, fid, fio.StandardFIO)
+	if err != nil {
+		return 0, false, err
+	}
+	defer dataFile.Close()
+
+	var offset int64 = 0
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+
+		if _, recordSeqNo := parseLogRecordKey(logRecord.Key); recordSeqNo > seqNo {
+			return offset, true, nil
+		}
+		offset += size
+	}
+}
+
+// 获取hint文件中最大的序列号
+func maxHintSeqNo(fsys fio.FS, dirPath string) (uint64, error) {
+	if _, err := fsys.Stat(filepath.Join(dirPath, data.HintFileName)); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	hintFile, err := data.OpenHintFile(fsys, dirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer hintFile.Close()
+
+	var maxSeqNo uint64
+	var offset int64 = 0
+	for {
+		hintRecord, n, err := hintFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, err
+		}
+		if pos := data.DecodeLogRecordPos(hintRecord.Value); pos.Version > maxSeqNo {
+			maxSeqNo = pos.Version
+		}
+		offset += n
+	}
+	return maxSeqNo, nil
+}
+
+// 获取需要备份的文件及其大小：数据文件、hint文件和merge完成文件
+func backupFiles(fsys fio.FS, dirPath string) (map[string]backupFileInfo, error) {
+	entries, err := fsys.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]backupFileInfo)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, data.DataFileNameSuffix) && name != data.HintFileName && name != data.MergeFinishedFileName {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files[name] = backupFileInfo{Inode: fio.Inode(info), Size: info.Size()}
+	}
+	return files, nil
+}
+
+func readBackupManifest(fsys fio.FS, dir string) (*backupManifest, error) {
+	manifest := &backupManifest{Files: make(map[string]backupFileInfo)}
+	buf, err := fsys.ReadFile(filepath.Join(dir, backupManifestName))
+	if os.IsNotExist(err) {
+		return manifest, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(buf, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// 先写临时文件再重命名，保证清单的原子性
+func writeBackupManifest(fsys fio.FS, dir string, manifest *backupManifest) error {
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(dir, backupManifestName+".tmp")
+	if err := fsys.WriteFile(tmpPath, buf); err != nil {
+		return err
+	}
+	return fsys.Rename(tmpPath, filepath.Join(dir, backupManifestName))
+}
@@ -0,0 +1,108 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_IncrementalBackUp(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-backup-1")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-backup-2")
+	defer os.RemoveAll(backupDir)
+
+	// 1.第一次备份拷贝所有文件
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.IncrementalBackUp(backupDir)
+	assert.Nil(t, err)
+	_, seqNo, err := db.GetWithVersion(utils.GetTestKey(999))
+	assert.Nil(t, err)
+
+	firstFile := filepath.Join(backupDir, filepath.Base(data.GetFileName(dir, 0)))
+	stat1, err := os.Stat(firstFile)
+	assert.Nil(t, err)
+
+	// 2.第二次备份只拷贝新增的数据
+	for i := 1000; i < 2000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	err = db.IncrementalBackUp(backupDir)
+	assert.Nil(t, err)
+
+	stat2, err := os.Stat(firstFile)
+	assert.Nil(t, err)
+	assert.Equal(t, stat1.ModTime(), stat2.ModTime())
+
+	// 3.恢复全部数据
+	target1, _ := os.MkdirTemp("", "bitcask-go-restore-1")
+	err = Restore(backupDir, target1, 0)
+	assert.Nil(t, err)
+	opts1 := opts
+	opts1.DirPath = target1
+	db1, err := OpenDB(opts1)
+	defer destroyDB(db1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1999, len(db1.ListKeys()))
+
+	// 4.恢复到第一次备份时的状态
+	target2, _ := os.MkdirTemp("", "bitcask-go-restore-2")
+	err = Restore(backupDir, target2, seqNo)
+	assert.Nil(t, err)
+	opts2 := opts
+	opts2.DirPath = target2
+	db2, err := OpenDB(opts2)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// 目标目录不为空
+	err = Restore(backupDir, target2, 0)
+	assert.Equal(t, ErrTargetDirNotEmpty, err)
+
+	// 5.merge之后同名文件被替换，需要重新拷贝
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	err = db.IncrementalBackUp(backupDir)
+	assert.Nil(t, err)
+
+	target3, _ := os.MkdirTemp("", "bitcask-go-restore-3")
+	err = Restore(backupDir, target3, 0)
+	assert.Nil(t, err)
+	opts3 := opts
+	opts3.DirPath = target3
+	db3, err := OpenDB(opts3)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1999, len(db3.ListKeys()))
+
+	// merge之前的时间点已经无法恢复
+	target4, _ := os.MkdirTemp("", "bitcask-go-restore-4")
+	defer os.RemoveAll(target4)
+	err = Restore(backupDir, target4, seqNo)
+	assert.Equal(t, ErrRestorePointMerged, err)
+}
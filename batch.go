@@ -21,10 +21,6 @@ type WriteBatch struct {
 
 // 初始化WriteBatch
 func (db *DB) NewWriteBatch(opt WriteBatchOptions) *WriteBatch {
-	if db.opt.IndexType == BPlusTree && !db.seqNoFileExists && !db.isInitial {
-		panic("cannot use write batch, seq no file not exists")
-	}
-
 	return &WriteBatch{
 		options:       opt,
 		mu:            new(sync.Mutex),
@@ -35,6 +31,30 @@ func (db *DB) NewWriteBatch(opt WriteBatchOptions) *WriteBatch {
 
 // 批量写数据
 func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	return wb.put(nil, key, value)
+}
+
+// 批量写数据到指定命名空间，同一批次可以包含多个命名空间的数据
+func (wb *WriteBatch) PutIn(ns *Namespace, key []byte, value []byte) error {
+	return wb.put(ns, key, value)
+}
+
+// 删除数据
+func (wb *WriteBatch) Delete(key []byte) error {
+	return wb.delete(nil, key)
+}
+
+// 删除指定命名空间中的数据
+func (wb *WriteBatch) DeleteIn(ns *Namespace, key []byte) error {
+	return wb.delete(ns, key)
+}
+
+// ns为nil表示默认命名空间
+func (wb *WriteBatch) put(ns *Namespace, key []byte, value []byte) error {
+	if wb.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
@@ -42,14 +62,18 @@ func (wb *WriteBatch) Put(key []byte, value []byte) error {
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
-	logRecord := &data.LogRecord{Key: key, Value: value}
+	logRecord := newBatchRecord(ns, key)
+	logRecord.Value = value
 	// 暂存写记录
-	wb.pendingWrites[string(key)] = logRecord
+	wb.pendingWrites[pendingKey(logRecord)] = logRecord
 	return nil
 }
 
-// 删除数据
-func (wb *WriteBatch) Delete(key []byte) error {
+func (wb *WriteBatch) delete(ns *Namespace, key []byte) error {
+	if wb.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
@@ -57,23 +81,31 @@ func (wb *WriteBatch) Delete(key []byte) error {
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
+	idx := wb.db.index
+	if ns != nil {
+		idx = ns.index
+	}
+
+	logRecord := newBatchRecord(ns, key)
 	// 待删除数据不存在，直接返回
-	logRecordPos := wb.db.index.Get(key)
+	logRecordPos := idx.Get(key)
 	if logRecordPos == nil {
-		if wb.pendingWrites[string(key)] != nil {
-			delete(wb.pendingWrites, string(key))
-		}
+		delete(wb.pendingWrites, pendingKey(logRecord))
 		return nil
 	}
 
 	// 设立墓碑
-	logRecord := &data.LogRecord{Key: key, Type: data.LogRecordDeleted}
-	wb.pendingWrites[string(key)] = logRecord
+	logRecord.Type = data.LogRecordDeleted
+	wb.pendingWrites[pendingKey(logRecord)] = logRecord
 	return nil
 }
 
 // 提交事务，将暂存的数据写到数据文件，并更新内存索引
 func (wb *WriteBatch) Commit() error {
+	if wb.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 
@@ -99,12 +131,13 @@ func (wb *WriteBatch) Commit() error {
 			Key:   logRecordKeyWithSeqNo(record.Key, seqNo),
 			Value: record.Value,
 			Type:  record.Type,
+			Flags: record.Flags,
 		})
 		if err != nil {
 			return err
 		}
 		// 暂存所有日志记录的position索引
-		positions[string(record.Key)] = pos
+		positions[pendingKey(record)] = pos
 	}
 
 	// 原子性关键：事务完成标识
@@ -126,16 +159,21 @@ func (wb *WriteBatch) Commit() error {
 	// 批量更新内存索引
 	for _, record := range wb.pendingWrites {
 		var oldPos *data.LogRecordPos
-		pos := positions[string(record.Key)]
+		pos := positions[pendingKey(record)]
+		idx, ns, key := wb.db.resolveKey(record.Key, record.Flags, true)
 		if record.Type == data.LogRecordNormal {
-			oldPos = wb.db.index.Put(record.Key, pos)
+			oldPos = idx.Put(key, pos)
+			wb.db.addHistory(ns, key, oldPos)
 		} else {
-			oldPos, _ = wb.db.index.Delete(record.Key) // 重要：暂存操作可能包含删除操作
-			wb.db.reclaimSize += int64(pos.Size)
+			oldPos, _ = idx.Delete(key) // 重要：暂存操作可能包含删除操作
+			wb.db.addReclaimSize(ns, pos.Size)
+			if oldPos != nil {
+				wb.db.addHistory(ns, key, oldPos, pos)
+			}
 		}
 
 		if oldPos != nil {
-			wb.db.reclaimSize += int64(oldPos.Size)
+			wb.db.addReclaimSize(ns, oldPos.Size)
 		}
 	}
 
@@ -145,6 +183,19 @@ func (wb *WriteBatch) Commit() error {
 	return nil
 }
 
+// 构造暂存的日志记录，命名空间中的key需要编码命名空间名称
+func newBatchRecord(ns *Namespace, key []byte) *data.LogRecord {
+	if ns == nil {
+		return &data.LogRecord{Key: key}
+	}
+	return &data.LogRecord{Key: encodeNamespaceKey(ns.name, key), Flags: data.LogRecordNamespaced}
+}
+
+// 暂存记录的唯一标识，区分不同命名空间中相同的key
+func pendingKey(record *data.LogRecord) string {
+	return string([]byte{record.Flags}) + string(record.Key)
+}
+
 // 带序列号的key
 func logRecordKeyWithSeqNo(key []byte, seqNo uint64) []byte {
 	seq := make([]byte, binary.MaxVarintLen64)
@@ -157,8 +208,10 @@ func logRecordKeyWithSeqNo(key []byte, seqNo uint64) []byte {
 }
 
 // 解析logRecord的key，获取实际的key和事务序列号
+// 兼容性：写入一直使用PutVarint，磁盘格式没有变化。旧版本用Uvarint解析，两者读取的字节数相同，实际key不受影响，
+// 只是得到的序列号是实际值的两倍；旧版本保存的序列号文件可能偏大，序列号仍然单调递增
 func parseLogRecordKey(key []byte) ([]byte, uint64) {
-	seqNo, n := binary.Uvarint(key)
+	seqNo, n := binary.Varint(key) // 与logRecordKeyWithSeqNo的编码方式保持一致
 	realKey := key[n:]
-	return realKey, seqNo
+	return realKey, uint64(seqNo)
 }
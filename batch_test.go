@@ -1,7 +1,11 @@
 package bitcask
 
 import (
+	"bitcask/data"
+	"bitcask/fio"
 	"bitcask/utils"
+	"encoding/binary"
+	"fmt"
 	"os"
 	"testing"
 
@@ -125,3 +129,59 @@ func TestDB_WriteBatch3(t *testing.T) {
 	// err = wb.Commit()
 	// assert.Nil(t, err)
 }
+
+func TestDB_WriteBatch_ReplayVarintSeqNo(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-batch-varint")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+
+	// 按旧版本的写入方式构造数据文件：key前缀为PutVarint编码的序列号，300的编码占两个字节
+	dataFile, err := data.OpenDataFile(fio.OSFS{}, dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	withSeqNo := func(key []byte, seqNo int64) []byte {
+		buf := binary.AppendVarint(nil, seqNo)
+		return append(buf, key...)
+	}
+	records := []*data.LogRecord{
+		{Key: withSeqNo(utils.GetTestKey(1), 0), Value: []byte("value-1")},
+		{Key: withSeqNo(utils.GetTestKey(2), 300), Value: []byte("value-2")},
+		{Key: withSeqNo(utils.GetTestKey(3), 300), Value: []byte("value-3")},
+		{Key: withSeqNo(txnFinKey, 300), Type: data.LogRecordTxnFinished},
+		// 未提交的事务
+		{Key: withSeqNo(utils.GetTestKey(4), 301), Value: []byte("value-4")},
+	}
+	for _, record := range records {
+		encRecord, _ := data.EncodeLogRecord(record)
+		err := dataFile.Write(encRecord)
+		assert.Nil(t, err)
+	}
+	err = dataFile.Close()
+	assert.Nil(t, err)
+
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+	assert.Equal(t, 3, len(db.ListKeys()))
+	for i := 1; i <= 3; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("value-%d", i)), val)
+	}
+	_, err = db.Get(utils.GetTestKey(4))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, version, err := db.GetWithVersion(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(300), version)
+
+	// 新的事务序列号大于已有的序列号
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(5), []byte("value-5"))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+	_, version, err = db.GetWithVersion(utils.GetTestKey(5))
+	assert.Nil(t, err)
+	assert.Greater(t, version, uint64(301))
+}
@@ -2,6 +2,7 @@ package benchmark
 
 import (
 	"bitcask"
+	"bitcask/fio"
 	"bitcask/utils"
 	"fmt"
 	"math/rand"
@@ -69,3 +70,74 @@ func Benchmark_Delete(b *testing.B) {
 		}
 	}
 }
+
+// 比较旧的数据文件使用FileIO和MMap时的读取延迟
+func Benchmark_GetOlderFiles_FileIO(b *testing.B) {
+	benchmarkGetOlderFiles(b, false)
+}
+
+func Benchmark_GetOlderFiles_MMap(b *testing.B) {
+	benchmarkGetOlderFiles(b, true)
+}
+
+func benchmarkGetOlderFiles(b *testing.B, mmapOlderFiles bool) {
+	opt := bitcask.DefaultOptions
+	opt.DirPath, _ = os.MkdirTemp("", "bitcask-go-bench-older")
+	opt.DataFileSize = 8 * 1024 * 1024
+	opt.MMapOlderFiles = mmapOlderFiles
+	olderDB, err := bitcask.OpenDB(opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = olderDB.Close()
+		_ = os.RemoveAll(opt.DirPath)
+	}()
+
+	// 写入的数据大部分位于旧的数据文件中
+	const keyNum = 50000
+	for i := 0; i < keyNum; i++ {
+		err := olderDB.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(b, err)
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := olderDB.Get(utils.GetTestKey(rand.Intn(keyNum))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 比较活跃文件使用FileIO和带写缓冲的FileIO时小value的写入延迟
+func Benchmark_PutSmall_FileIO(b *testing.B) {
+	benchmarkPutSmall(b, fio.StandardFIO)
+}
+
+func Benchmark_PutSmall_BufferedFIO(b *testing.B) {
+	benchmarkPutSmall(b, fio.BufferedFIO)
+}
+
+func benchmarkPutSmall(b *testing.B, ioType fio.FileIOType) {
+	opt := bitcask.DefaultOptions
+	opt.DirPath, _ = os.MkdirTemp("", "bitcask-go-bench-put")
+	opt.IOType = ioType
+	putDB, err := bitcask.OpenDB(opt)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = putDB.Close()
+		_ = os.RemoveAll(opt.DirPath)
+	}()
+
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		err := putDB.Put(utils.GetTestKey(i), utils.RandomValue(16))
+		assert.Nil(b, err)
+	}
+}
@@ -0,0 +1,115 @@
+package bitcask
+
+import (
+	"bytes"
+)
+
+// 比较并交换：key当前的值与expected相同时写入value，返回是否写入成功
+// expected为nil表示要求key不存在，空切片表示要求key存在且值为空
+func (db *DB) CompareAndSwap(key, expected, value []byte) (bool, error) {
+	if db.opt.ReadOnly {
+		return false, ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, err := db.getValueByPosition(db.index.Get(key))
+	if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+
+	// key是否存在以及值是否相同都需要匹配
+	exists := err == nil
+	if exists != (expected != nil) || !bytes.Equal(old, expected) {
+		return false, nil
+	}
+
+	if err := db.put(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// key不存在时写入value，返回是否写入成功
+func (db *DB) PutIfAbsent(key, value []byte) (bool, error) {
+	if db.opt.ReadOnly {
+		return false, ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if pos := db.index.Get(key); pos != nil {
+		return false, nil
+	}
+
+	if err := db.put(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// key当前的版本号与seq相同时写入value，返回是否写入成功
+// key不存在时返回ErrKeyNotFound，要求key不存在时使用PutIfAbsent；引入版本号之前写入的key版本号为0
+func (db *DB) PutIfVersion(key, value []byte, seq uint64) (bool, error) {
+	if db.opt.ReadOnly {
+		return false, ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pos := db.index.Get(key)
+	if pos == nil {
+		return false, ErrKeyNotFound
+	}
+	if pos.Version != seq {
+		return false, nil
+	}
+
+	if err := db.put(key, value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 原子地读取并更新key的值，old为nil表示key不存在
+// fn返回错误时不写入数据并返回该错误
+// fn在持有数据库锁的情况下执行，不能在fn中再调用数据库的方法
+func (db *DB) Update(key []byte, fn func(old []byte) ([]byte, error)) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	old, err := db.getValueByPosition(db.index.Get(key))
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+
+	value, err := fn(old)
+	if err != nil {
+		return err
+	}
+
+	return db.put(key, value)
+}
@@ -0,0 +1,210 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"bitcask/utils"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CompareAndSwap(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-1")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.key不存在
+	ok, err := db.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap(utils.GetTestKey(1), nil, []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 2.值匹配与不匹配
+	ok, err = db.CompareAndSwap(utils.GetTestKey(1), []byte("x"), []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap(utils.GetTestKey(1), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	// 3.值为空
+	err = db.Put(utils.GetTestKey(2), nil)
+	assert.Nil(t, err)
+	ok, err = db.CompareAndSwap(utils.GetTestKey(2), nil, []byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.CompareAndSwap(utils.GetTestKey(2), []byte{}, []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 4.key为空
+	_, err = db.CompareAndSwap(nil, nil, []byte("c"))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+}
+
+func TestDB_PutIfAbsent(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-2")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	ok, err := db.PutIfAbsent(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.PutIfAbsent(utils.GetTestKey(1), []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	// 删除之后可以重新写入
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	ok, err = db.PutIfAbsent(utils.GetTestKey(1), []byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestDB_PutIfVersion(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-3")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	ok, err := db.PutIfVersion(utils.GetTestKey(1), []byte("b"), db.seqNo+1)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.PutIfVersion(utils.GetTestKey(1), []byte("b"), db.seqNo)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	// 非事务写入同样分配版本号
+	_, version, err := db.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	ok, err = db.PutIfVersion(utils.GetTestKey(1), []byte("c"), version-1)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.PutIfVersion(utils.GetTestKey(1), []byte("c"), version)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// key不存在时不会当作版本号0写入
+	ok, err = db.PutIfVersion(utils.GetTestKey(2), []byte("a"), 0)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.False(t, ok)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_PutIfVersion_Unversioned(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-unversioned")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+
+	// 按引入版本号之前的方式写入，记录没有版本号
+	dataFile, err := data.OpenDataFile(fio.OSFS{}, dir, 0, fio.StandardFIO)
+	assert.Nil(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeqNo(utils.GetTestKey(1), nonTransactionSeqNo),
+		Value: []byte("a"),
+	})
+	err = dataFile.Write(encRecord)
+	assert.Nil(t, err)
+	err = dataFile.Close()
+	assert.Nil(t, err)
+
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 已存在的key版本号为0，PutIfVersion按版本号匹配，PutIfAbsent不会覆盖
+	_, version, err := db.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), version)
+	ok, err := db.PutIfAbsent(utils.GetTestKey(1), []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.PutIfVersion(utils.GetTestKey(1), []byte("c"), 0)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+}
+
+func TestDB_Update(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-cas-4")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	incr := func(old []byte) ([]byte, error) {
+		n, _ := strconv.Atoi(string(old))
+		return []byte(strconv.Itoa(n + 1)), nil
+	}
+
+	// 并发计数器
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				err := db.Update([]byte("counter"), incr)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, err := db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("800"), val)
+
+	// fn返回错误时不写入数据
+	errAbort := errors.New("abort")
+	err = db.Update([]byte("counter"), func(old []byte) ([]byte, error) {
+		return nil, errAbort
+	})
+	assert.Equal(t, errAbort, err)
+	val, err = db.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("800"), val)
+}
@@ -0,0 +1,116 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"bitcask/index"
+	"os"
+	"path/filepath"
+)
+
+// 创建检查点：切换活跃文件使所有数据文件不再被修改，然后将数据文件和hint文件硬链接到dir中
+// 跨文件系统无法硬链接时退化为拷贝。最后一个数据文件和B+树索引文件之后会被修改，总是拷贝
+// 生成的目录可以直接通过OpenDB打开
+func (db *DB) Checkpoint(dir string) error {
+	// 只读模式无法切换活跃文件
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	entries, err := db.opt.FS.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		return ErrTargetDirNotEmpty
+	}
+	if err := db.opt.FS.MkdirAll(dir); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 封存当前活跃文件，之后的写入进入新的活跃文件
+	var activeFileId uint32
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+		if db.activeFile.WriteOff > 0 {
+			if err := db.setActiveDataFile(); err != nil {
+				return err
+			}
+		}
+		activeFileId = db.activeFile.FileID
+	}
+
+	// 数据文件：新的活跃文件仍会被追加写，不需要包含
+	fileIds, err := listDataFileIds(db.opt.FS, db.opt.DirPath)
+	if err != nil {
+		return err
+	}
+	if db.activeFile != nil && len(fileIds) > 0 && uint32(fileIds[len(fileIds)-1]) == activeFileId {
+		fileIds = fileIds[:len(fileIds)-1]
+	}
+	for i, fid := range fileIds {
+		src := data.GetFileName(db.opt.DirPath, uint32(fid))
+		dst := data.GetFileName(dir, uint32(fid))
+		// 检查点打开之后会向最后一个数据文件追加写，必须拷贝，避免修改原数据库的文件
+		if i == len(fileIds)-1 {
+			err = copyFile(db.opt.FS, src, dst)
+		} else {
+			err = linkOrCopyFile(db.opt.FS, src, dst)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// hint文件和merge完成文件只会被整体替换
+	for _, name := range []string{data.HintFileName, data.MergeFinishedFileName} {
+		src, dst := filepath.Join(db.opt.DirPath, name), filepath.Join(dir, name)
+		if _, err := db.opt.FS.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := linkOrCopyFile(db.opt.FS, src, dst); err != nil {
+			return err
+		}
+	}
+
+	// B+树索引文件会被原地修改
+	if db.opt.IndexType == BPlusTree {
+		name := index.BPTreeIndexFileName
+		if err := copyFile(db.opt.FS, filepath.Join(db.opt.DirPath, name), filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	// 元数据只包含检查点中的数据文件
+	checkpointFileIds := make([]uint32, 0, len(fileIds))
+	for _, fid := range fileIds {
+		checkpointFileIds = append(checkpointFileIds, uint32(fid))
+	}
+	if err := writeManifest(db.opt.FS, dir, db.newManifest(checkpointFileIds)); err != nil {
+		return err
+	}
+
+	// B+树索引启动时需要读取序列号
+	return db.saveSeqNo(dir)
+}
+
+// 创建硬链接，失败时拷贝文件
+func linkOrCopyFile(fsys fio.FS, src, dst string) error {
+	if err := fsys.Link(src, dst); err == nil {
+		return nil
+	}
+	return copyFile(fsys, src, dst)
+}
+
+func copyFile(fsys fio.FS, src, dst string) error {
+	info, err := fsys.Stat(src)
+	if err != nil {
+		return err
+	}
+	return fio.CopyFileRange(fsys, src, dst, 0, info.Size())
+}
@@ -0,0 +1,98 @@
+package bitcask
+
+import (
+	"bitcask/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-1")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	cpDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-2")
+	err = db.Checkpoint(cpDir)
+	assert.Nil(t, err)
+
+	// 检查点之后的写入不影响检查点
+	for i := 1000; i < 1100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	cpOpts := opts
+	cpOpts.DirPath = cpDir
+	cp, err := OpenDB(cpOpts)
+	defer destroyDB(cp)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(cp.ListKeys()))
+	_, err = cp.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// 写入检查点不影响原数据库
+	for i := 2000; i < 2100; i++ {
+		err := cp.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1099, len(db.ListKeys()))
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1099, len(db.ListKeys()))
+
+	// 目标目录不为空
+	err = db.Checkpoint(cpDir)
+	assert.Equal(t, ErrTargetDirNotEmpty, err)
+}
+
+func TestDB_Checkpoint_BPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-3")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+
+	cpDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-4")
+	err = db.Checkpoint(cpDir)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(100), utils.RandomValue(24))
+	assert.Nil(t, err)
+
+	cpOpts := opts
+	cpOpts.DirPath = cpDir
+	cp, err := OpenDB(cpOpts)
+	defer destroyDB(cp)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(cp.ListKeys()))
+
+	// 检查点中保存了序列号，可以继续批量写入
+	wb := cp.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(200), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/utils"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Checkpoint_HardLink(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-link")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	cpDir, _ := os.MkdirTemp("", "bitcask-go-checkpoint-link-cp")
+	defer os.RemoveAll(cpDir)
+	err = db.Checkpoint(cpDir)
+	assert.Nil(t, err)
+
+	// 旧的数据文件是硬链接
+	info, err := os.Stat(data.GetFileName(cpDir, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), uint64(info.Sys().(*syscall.Stat_t).Nlink))
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bitcask"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// 数据导出导入工具
+//
+//	bitcask export -dir <db> [-file <path>] [-format binary|jsonl] [-index btree|art|bptree|skiplist]
+//	bitcask import -dir <db> [-file <path>] [-format binary|jsonl] [-index btree|art|bptree|skiplist]
+//
+// 未指定file时从标准输入读取或写入标准输出；未指定index时使用目录元数据中记录的索引类型，没有记录时使用btree
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dir := fs.String("dir", "", "database directory")
+	file := fs.String("file", "", "export file, stdin/stdout by default")
+	format := fs.String("format", "binary", "export format: binary or jsonl")
+	indexType := fs.String("index", "", "index type: btree, art, bptree or skiplist, read from MANIFEST by default")
+	_ = fs.Parse(os.Args[2:])
+	if *dir == "" {
+		usage()
+	}
+
+	opt := bitcask.DefaultOptions
+	opt.DirPath = *dir
+	switch *indexType {
+	case "":
+		typ, ok, err := bitcask.ReadIndexType(opt)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read index type failed: %v\n", err)
+			os.Exit(1)
+		}
+		if ok {
+			opt.IndexType = typ
+		}
+	case "btree":
+		opt.IndexType = bitcask.Btree
+	case "art":
+		opt.IndexType = bitcask.ART
+	case "bptree":
+		opt.IndexType = bitcask.BPlusTree
+	case "skiplist":
+		opt.IndexType = bitcask.SkipList
+	default:
+		usage()
+	}
+
+	var err error
+	switch cmd {
+	case "export":
+		err = runExport(opt, *file, *format)
+	case "import":
+		err = runImport(opt, *file, *format)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", cmd, err)
+		os.Exit(1)
+	}
+}
+
+func runExport(opt bitcask.Options, file, format string) error {
+	// 只读打开，不影响正在运行的写进程
+	opt.ReadOnly = opt.IndexType != bitcask.BPlusTree
+	db, err := bitcask.OpenDB(opt)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "binary":
+		return db.Export(w)
+	case "jsonl":
+		return db.ExportJSONLines(w)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func runImport(opt bitcask.Options, file, format string) error {
+	db, err := bitcask.OpenDB(opt)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var r io.Reader = os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch format {
+	case "binary":
+		err = db.Import(r)
+	case "jsonl":
+		err = db.ImportJSONLines(r)
+	default:
+		err = fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Sync()
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bitcask <export|import> -dir <db> [-file <path>] [-format binary|jsonl] [-index btree|art|bptree|skiplist]")
+	os.Exit(2)
+}
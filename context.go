@@ -0,0 +1,112 @@
+package bitcask
+
+import (
+	"bitcask/fio"
+	"context"
+)
+
+func (db *DB) GetCtx(ctx context.Context, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	if err := db.rlockCtx(ctx); err != nil {
+		return nil, err
+	}
+	defer db.mu.RUnlock()
+
+	return db.getValueByPosition(db.index.Get(key))
+}
+
+func (db *DB) PutCtx(ctx context.Context, key []byte, value []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	return db.put(key, value)
+}
+
+func (db *DB) DeleteCtx(ctx context.Context, key []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	return db.delete(key)
+}
+
+// 获取所有数据并执行用户指定操作，ctx取消时停止遍历并返回ctx.Err()
+func (db *DB) FoldCtx(ctx context.Context, fn func(key []byte, value []byte) bool) error {
+	return db.fold(ctx, db.index, fn)
+}
+
+// 备份数据库，ctx取消时停止拷贝并返回ctx.Err()，目标目录中可能残留部分文件
+func (db *DB) BackUpCtx(ctx context.Context, dir string) error {
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
+	defer db.mu.Unlock()
+
+	// 活跃文件可能有尚未写入文件的缓冲数据
+	if db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	return fio.CopyDir(ctx, db.opt.FS, db.opt.DirPath, dir, []string{fileLockName, readerLockName}) // 排除文件锁
+}
+
+// 获取互斥锁，ctx取消时放弃等待并返回ctx.Err()
+func (db *DB) lockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, db.mu.TryLock, db.mu.Lock, db.mu.Unlock)
+}
+
+// 获取读锁，ctx取消时放弃等待并返回ctx.Err()
+func (db *DB) rlockCtx(ctx context.Context) error {
+	return acquireCtx(ctx, db.mu.TryRLock, db.mu.RLock, db.mu.RUnlock)
+}
+
+// 在后台协程中等待锁，ctx先取消时由该协程在拿到锁之后立即释放
+func acquireCtx(ctx context.Context, tryLock func() bool, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if tryLock() {
+		return nil
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		lock()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-acquired
+			unlock()
+		}()
+		return ctx.Err()
+	}
+}
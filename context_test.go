@@ -0,0 +1,93 @@
+package bitcask
+
+import (
+	"bitcask/utils"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_PutCtx(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ctx-1")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.正常读写
+	err = db.PutCtx(context.Background(), utils.GetTestKey(1), []byte("a"))
+	assert.Nil(t, err)
+	val, err := db.GetCtx(context.Background(), utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	// 2.等待锁超时
+	db.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = db.PutCtx(ctx, utils.GetTestKey(2), []byte("b"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	_, err = db.GetCtx(ctx, utils.GetTestKey(1))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	db.mu.Unlock()
+
+	// 3.放弃等待的锁会被释放，不影响后续操作
+	err = db.Put(utils.GetTestKey(2), []byte("b"))
+	assert.Nil(t, err)
+	err = db.DeleteCtx(context.Background(), utils.GetTestKey(1))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 4.已经取消的ctx
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	cancel2()
+	err = db.PutCtx(ctx2, utils.GetTestKey(3), []byte("c"))
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDB_FoldCtx(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-ctx-2")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+
+	// 遍历中途取消
+	ctx, cancel := context.WithCancel(context.Background())
+	var count int
+	err = db.FoldCtx(ctx, func(key []byte, value []byte) bool {
+		count++
+		if count == 10 {
+			cancel()
+		}
+		return true
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 10, count)
+
+	// 已经取消的ctx
+	err = db.MergeCtx(ctx)
+	assert.Equal(t, context.Canceled, err)
+	backupDir, _ := os.MkdirTemp("", "bitcask-go-ctx-backup")
+	defer os.RemoveAll(backupDir)
+	err = db.BackUpCtx(ctx, backupDir)
+	assert.Equal(t, context.Canceled, err)
+
+	// 取消之后仍然可以正常merge
+	err = db.MergeCtx(context.Background())
+	assert.Nil(t, err)
+}
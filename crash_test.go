@@ -0,0 +1,208 @@
+package bitcask
+
+import (
+	"bitcask/fio"
+	"bitcask/utils"
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 故障和崩溃方式的组合：进程退出保留已写入的数据，掉电丢弃未持久化的数据
+var crashModes = []struct {
+	name         string
+	kind         fio.FaultKind
+	dropUnsynced bool
+}{
+	{"error-process", fio.FaultError, false},
+	{"error-power", fio.FaultError, true},
+	{"short-write-process", fio.FaultShortWrite, false},
+	{"short-write-power", fio.FaultShortWrite, true},
+}
+
+// 对op的每一个IO步骤分别注入故障并模拟崩溃，重新打开之后由check检查数据的一致性
+// 每次注入故障之前由setup重新构造相同的初始数据，直到op在注入故障之前完成
+func runCrashTest(t *testing.T, setup func(db *DB) error, op func(db *DB) error, check func(t *testing.T, db *DB, opErr error)) {
+	for _, mode := range crashModes {
+		t.Run(mode.name, func(t *testing.T) {
+			for step := 1; ; step++ {
+				fsys := fio.NewFaultFS()
+				opts := DefaultOptions
+				opts.DirPath = "/bitcask-go-crash"
+				opts.DataFileSize = 4 * 1024
+				opts.DataFileMergeRatio = 0
+				opts.SyncWrites = true
+				opts.FS = fsys
+
+				db, err := OpenDB(opts)
+				if !assert.Nil(t, err) || !assert.Nil(t, setup(db)) {
+					return
+				}
+
+				fsys.InjectAfter(step, mode.kind)
+				opErr := op(db)
+				failed := fsys.Failed()
+				fsys.Crash(mode.dropUnsynced)
+
+				db, err = OpenDB(opts)
+				if !assert.Nil(t, err, "reopen after crash at step %d", step) {
+					return
+				}
+				check(t, db, opErr)
+				assert.Nil(t, db.Close())
+				if t.Failed() {
+					t.Fatalf("inconsistent after crash at step %d: %v", step, opErr)
+				}
+
+				// op在注入故障之前已经完成
+				if !failed {
+					return
+				}
+			}
+		})
+	}
+}
+
+func crashTestValue(i int, version string) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("%d-%s;", i, version)), 4)
+}
+
+// 检查key的值，value为nil表示key不存在
+func assertCrashTestValue(t *testing.T, db *DB, i int, value []byte) {
+	val, err := db.Get(utils.GetTestKey(i))
+	if value == nil {
+		assert.Equal(t, ErrKeyNotFound, err, "key %d", i)
+		return
+	}
+	assert.Nil(t, err, "key %d", i)
+	assert.Equal(t, value, val, "key %d", i)
+}
+
+func TestCrash_WriteBatchCommit(t *testing.T) {
+	setup := func(db *DB) error {
+		for i := 0; i < 200; i++ {
+			if err := db.Put(utils.GetTestKey(i), crashTestValue(i, "v1")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	op := func(db *DB) error {
+		wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+		for i := 0; i < 50; i++ {
+			_ = wb.Put(utils.GetTestKey(i), crashTestValue(i, "v2"))
+			_ = wb.Delete(utils.GetTestKey(i + 50))
+		}
+		return wb.Commit()
+	}
+
+	// 事务要么全部生效，要么全部不生效；Commit成功时必须全部生效
+	check := func(t *testing.T, db *DB, opErr error) {
+		val, err := db.Get(utils.GetTestKey(0))
+		assert.Nil(t, err)
+		committed := bytes.Equal(val, crashTestValue(0, "v2"))
+		if opErr == nil {
+			assert.True(t, committed)
+		}
+
+		for i := 0; i < 200; i++ {
+			switch {
+			case committed && i < 50:
+				assertCrashTestValue(t, db, i, crashTestValue(i, "v2"))
+			case committed && i < 100:
+				assertCrashTestValue(t, db, i, nil)
+			default:
+				assertCrashTestValue(t, db, i, crashTestValue(i, "v1"))
+			}
+		}
+	}
+
+	runCrashTest(t, setup, op, check)
+}
+
+// merge过程中以及下次启动应用merge结果时崩溃，数据都不会丢失
+func TestCrash_Merge(t *testing.T) {
+	setup := func(db *DB) error {
+		for i := 0; i < 200; i++ {
+			if err := db.Put(utils.GetTestKey(i), crashTestValue(i, "v1")); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 100; i++ {
+			if err := db.Put(utils.GetTestKey(i), crashTestValue(i, "v2")); err != nil {
+				return err
+			}
+		}
+		for i := 100; i < 150; i++ {
+			if err := db.Delete(utils.GetTestKey(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	op := func(db *DB) error {
+		if err := db.Merge(); err != nil {
+			return err
+		}
+		if err := db.Close(); err != nil {
+			return err
+		}
+		db, err := OpenDB(db.opt)
+		if err != nil {
+			return err
+		}
+		return db.Close()
+	}
+
+	check := func(t *testing.T, db *DB, opErr error) {
+		assert.Equal(t, 150, len(db.ListKeys()))
+		for i := 0; i < 200; i++ {
+			switch {
+			case i < 100:
+				assertCrashTestValue(t, db, i, crashTestValue(i, "v2"))
+			case i < 150:
+				assertCrashTestValue(t, db, i, nil)
+			default:
+				assertCrashTestValue(t, db, i, crashTestValue(i, "v1"))
+			}
+		}
+	}
+
+	runCrashTest(t, setup, op, check)
+}
+
+func TestCrash_Close(t *testing.T) {
+	setup := func(db *DB) error {
+		for i := 0; i < 200; i++ {
+			if err := db.Put(utils.GetTestKey(i), crashTestValue(i, "v1")); err != nil {
+				return err
+			}
+		}
+		for i := 0; i < 50; i++ {
+			if err := db.Delete(utils.GetTestKey(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	op := func(db *DB) error {
+		return db.Close()
+	}
+
+	check := func(t *testing.T, db *DB, opErr error) {
+		for i := 0; i < 200; i++ {
+			if i < 50 {
+				assertCrashTestValue(t, db, i, nil)
+			} else {
+				assertCrashTestValue(t, db, i, crashTestValue(i, "v1"))
+			}
+		}
+	}
+
+	runCrashTest(t, setup, op, check)
+}
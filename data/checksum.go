@@ -0,0 +1,66 @@
+package data
+
+import (
+	"hash/crc32"
+	"io"
+
+	"github.com/zeebo/xxh3"
+)
+
+// 日志记录的校验算法，编码在type + flags字节的高2位，旧版本的记录高2位为0即CRC32-IEEE
+type ChecksumType = byte
+
+const (
+	ChecksumCRC32  ChecksumType = iota // CRC32-IEEE，默认算法
+	ChecksumCRC32C                     // CRC32-Castagnoli，有硬件指令加速
+	ChecksumXXH3                       // xxHash3，取64位结果的低32位
+)
+
+const (
+	checksumShift = 6
+	checksumMask  = 0xC0
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// 是否是可以识别的校验算法
+func ValidChecksum(typ ChecksumType) bool {
+	return typ <= ChecksumXXH3
+}
+
+// 流式计算32位校验值
+type checksumDigest interface {
+	io.Writer
+	Sum32() uint32
+}
+
+type xxh3Digest struct {
+	*xxh3.Hasher
+}
+
+func (d xxh3Digest) Sum32() uint32 {
+	return uint32(d.Sum64())
+}
+
+func newChecksumDigest(typ ChecksumType) checksumDigest {
+	switch typ {
+	case ChecksumCRC32C:
+		return crc32.New(castagnoliTable)
+	case ChecksumXXH3:
+		return xxh3Digest{xxh3.New()}
+	default:
+		return crc32.NewIEEE()
+	}
+}
+
+// 计算buf的校验值
+func checksum(typ ChecksumType, buf []byte) uint32 {
+	switch typ {
+	case ChecksumCRC32C:
+		return crc32.Checksum(buf, castagnoliTable)
+	case ChecksumXXH3:
+		return uint32(xxh3.Hash(buf))
+	default:
+		return crc32.ChecksumIEEE(buf)
+	}
+}
@@ -16,16 +16,26 @@ const (
 	SeqNoFileName         = "seq-no"
 )
 
-var ErrInvalidCRC = errors.New("invalid crc value, log record maybe corrupted")
+var (
+	ErrInvalidCRC          = errors.New("invalid crc value, log record maybe corrupted")
+	ErrInvalidFileChecksum = errors.New("invalid file checksum, data file maybe corrupted")
+	ErrPositionMismatch    = errors.New("the log record does not match its position")
+	ErrUnsupportedCodec    = errors.New("unsupported log record codec")
+)
 
 type DataFile struct {
 	FileID    uint32
 	WriteOff  int64
 	IoManager fio.IOManager
+
+	// 从文件开头累计计算的校验值，封存文件时不需要重新读取整个文件
+	digest     checksumDigest
+	digestType ChecksumType
+	digestOff  int64
 }
 
-func newDataFile(fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
-	ioManager, err := fio.NewIOManager(fileName, ioType)
+func newDataFile(fsys fio.FS, fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+	ioManager, err := fsys.OpenFile(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
@@ -38,39 +48,87 @@ func GetFileName(dirPath string, fileId uint32) string {
 }
 
 // 打开新的数据文件
-func OpenDataFile(dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+func OpenDataFile(fsys fio.FS, dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
 	fileName := GetFileName(dirPath, fileId)
-	return newDataFile(fileName, fileId, ioType)
+	return newDataFile(fsys, fileName, fileId, ioType)
 }
 
 // merge用，打开Hint文件
-func OpenHintFile(dirPath string) (*DataFile, error) {
+func OpenHintFile(fsys fio.FS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, HintFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fsys, fileName, 0, fio.StandardFIO)
 }
 
 // merge用，打开merge结束标识文件
-func OpenHintFinishedFile(dirPath string) (*DataFile, error) {
+func OpenHintFinishedFile(fsys fio.FS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, MergeFinishedFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fsys, fileName, 0, fio.StandardFIO)
 }
 
 // BPlusTree用，打开存储事务序列号的文件
-func OpenSeqNoFile(dirPath string) (*DataFile, error) {
+func OpenSeqNoFile(fsys fio.FS, dirPath string) (*DataFile, error) {
 	fileName := filepath.Join(dirPath, SeqNoFileName)
-	return newDataFile(fileName, 0, fio.StandardFIO)
+	return newDataFile(fsys, fileName, 0, fio.StandardFIO)
 }
 
 func (df *DataFile) Write(buf []byte) error {
 	n, err := df.IoManager.Write(buf)
 	if err != nil {
+		df.digest = nil
 		return err
 	}
 
+	if df.digest != nil && df.digestOff == df.WriteOff {
+		_, _ = df.digest.Write(buf[:n])
+		df.digestOff += int64(n)
+	}
 	df.WriteOff += int64(n)
 	return nil
 }
 
+// 从文件开头开始累计计算写入数据的校验值，只对新创建的空文件有效
+func (df *DataFile) TrackChecksum(typ ChecksumType) {
+	if df.WriteOff != 0 {
+		return
+	}
+	df.digest, df.digestType, df.digestOff = newChecksumDigest(typ), typ, 0
+}
+
+// 封存数据文件：在末尾追加尾部校验记录，记录文件在它之前所有数据的校验值
+func (df *DataFile) Seal(typ ChecksumType) error {
+	sum, err := df.fileChecksum(typ, df.WriteOff)
+	if err != nil {
+		return err
+	}
+
+	trailer := &LogRecord{
+		Value:    EncodeFileTrailer(df.WriteOff, sum),
+		Type:     LogRecordFileTrailer,
+		Checksum: typ,
+	}
+	encRecord, _ := EncodeLogRecord(trailer)
+	return df.Write(encRecord)
+}
+
+// 计算文件 [0, end) 范围内数据的校验值，累计的校验值不可用时读取文件计算
+func (df *DataFile) fileChecksum(typ ChecksumType, end int64) (uint32, error) {
+	if df.digest != nil && df.digestType == typ && df.digestOff == end {
+		return df.digest.Sum32(), nil
+	}
+
+	digest := newChecksumDigest(typ)
+	buf := make([]byte, min(end, 1024*1024))
+	for offset := int64(0); offset < end; {
+		n := min(int64(len(buf)), end-offset)
+		if _, err := df.IoManager.Read(buf[:n], offset); err != nil {
+			return 0, err
+		}
+		_, _ = digest.Write(buf[:n])
+		offset += n
+	}
+	return digest.Sum32(), nil
+}
+
 // 根据偏移量从数据文件中读取LogRecord
 func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	fileSize, err := df.IoManager.Size()
@@ -102,7 +160,18 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
 	var logRecordSize = headerSize + keySize + valueSize
 
-	logRecord := &LogRecord{Type: header.logRecordType}
+	if !ValidChecksum(header.checksum) {
+		return nil, 0, ErrInvalidCRC
+	}
+
+	logRecord := &LogRecord{
+		Type:      header.logRecordType,
+		Flags:     header.flags,
+		Timestamp: header.timestamp,
+		Checksum:  header.checksum,
+		Format:    header.format,
+		expiry:    header.expiry,
+	}
 
 	if keySize > 0 || valueSize > 0 {
 		kvBuf, err := df.readNBytes(keySize+valueSize, offset+headerSize)
@@ -120,15 +189,214 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	if crc != header.crc {
 		return nil, 0, ErrInvalidCRC
 	}
+	// 还没有支持任何编码方式，无法解析value
+	if header.codec != CodecNone {
+		return nil, 0, ErrUnsupportedCodec
+	}
 
 	return logRecord, logRecordSize, nil
 }
 
-// 写入索引信息到hint文件中
-func (df *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos) error {
+// 批量读取多个位置的日志记录，files与positions一一对应
+// 位置中记录了大小时整条读取，IOManager支持时所有读请求一次提交；否则退化为ReadLogRecord
+func ReadLogRecordsAt(files []*DataFile, positions []*LogRecordPos) ([]*LogRecord, []error) {
+	records := make([]*LogRecord, len(positions))
+	errs := make([]error, len(positions))
+
+	reqs := make([]*fio.ReadRequest, 0, len(positions))
+	indexes := make([]int, 0, len(positions))
+	for i, pos := range positions {
+		if pos.Size == 0 {
+			records[i], _, errs[i] = files[i].ReadLogRecord(pos.Offset)
+			continue
+		}
+		reqs = append(reqs, &fio.ReadRequest{
+			IO:     files[i].IoManager,
+			Buf:    make([]byte, pos.Size),
+			Offset: pos.Offset,
+		})
+		indexes = append(indexes, i)
+	}
+
+	fio.ReadBatch(reqs)
+	for j, req := range reqs {
+		i := indexes[j]
+		if req.Err != nil && !(req.Err == io.EOF && req.N == len(req.Buf)) {
+			errs[i] = req.Err
+			continue
+		}
+		records[i], errs[i] = decodeLogRecord(req.Buf)
+	}
+	return records, errs
+}
+
+const (
+	scanChunkSize = 64 * 1024 // 顺序扫描时一个读请求的大小
+	scanReadAhead = 8         // 顺序扫描时一次提交的读请求数
+)
+
+// 数据文件顺序扫描器，一次提交多个连续区间的读请求预读，用于merge等全量读取
+// 返回的记录引用预读的缓冲区，缓冲区不会被复用
+type RecordScanner struct {
+	df     *DataFile
+	size   int64
+	buf    []byte // 从bufOff开始预读的数据
+	bufOff int64
+	Offset int64 // 下一条记录的位置
+}
+
+func (df *DataFile) NewScanner() (*RecordScanner, error) {
+	size, err := df.IoManager.Size()
+	if err != nil {
+		return nil, err
+	}
+	return &RecordScanner{df: df, size: size}, nil
+}
+
+// 读取下一条记录，与ReadLogRecord一致，读到文件末尾或者不完整的记录时返回io.EOF
+func (s *RecordScanner) Next() (*LogRecord, int64, error) {
+	if err := s.fill(maxLogRecordHeaderSize); err != nil {
+		return nil, 0, err
+	}
+	header, headerSize := decodeLogRecordHeader(s.buf[s.Offset-s.bufOff:])
+	if header == nil {
+		return nil, 0, io.EOF
+	}
+	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
+		return nil, 0, io.EOF
+	}
+
+	size := headerSize + int64(header.keySize) + int64(header.valueSize)
+	if s.Offset+size > s.size {
+		return nil, 0, io.EOF
+	}
+	if err := s.fill(size); err != nil {
+		return nil, 0, err
+	}
+
+	start := s.Offset - s.bufOff
+	logRecord, err := decodeLogRecord(s.buf[start : start+size])
+	if err != nil {
+		return nil, 0, err
+	}
+	s.Offset += size
+	return logRecord, size, nil
+}
+
+// 保证缓冲区中包含从Offset开始的n个字节，不足时一次提交多个读请求继续预读，不超过文件末尾
+func (s *RecordScanner) fill(n int64) error {
+	end := min(s.Offset+n, s.size)
+	readOff := s.bufOff + int64(len(s.buf))
+	if end <= readOff {
+		return nil
+	}
+
+	readEnd := min(max(end, readOff+scanChunkSize*scanReadAhead), s.size)
+	buf := make([]byte, readEnd-s.Offset)
+	copy(buf, s.buf[s.Offset-s.bufOff:])
+
+	var reqs []*fio.ReadRequest
+	for off := readOff; off < readEnd; off += scanChunkSize {
+		reqs = append(reqs, &fio.ReadRequest{
+			IO:     s.df.IoManager,
+			Buf:    buf[off-s.Offset : min(off+scanChunkSize, readEnd)-s.Offset],
+			Offset: off,
+		})
+	}
+	fio.ReadBatch(reqs)
+	for _, req := range reqs {
+		if req.Err != nil && !(req.Err == io.EOF && req.N == len(req.Buf)) {
+			return req.Err
+		}
+	}
+
+	s.buf, s.bufOff = buf, s.Offset
+	return nil
+}
+
+// 数据文件校验器，从文件开头逐条校验记录，遇到尾部校验记录时校验文件在它之前所有数据的校验值
+type FileVerifier struct {
+	df     *DataFile
+	digest checksumDigest
+	typ    ChecksumType
+	Offset int64 // 下一条待校验记录的位置
+}
+
+// typ为累计计算文件校验值使用的算法，与尾部校验记录的算法不一致时重新读取文件计算
+func (df *DataFile) NewVerifier(typ ChecksumType) *FileVerifier {
+	return &FileVerifier{df: df, digest: newChecksumDigest(typ), typ: typ}
+}
+
+// 校验下一条记录，到达文件末尾时返回io.EOF，记录损坏时返回ErrInvalidCRC或ErrInvalidFileChecksum
+func (v *FileVerifier) Next() error {
+	fileSize, err := v.df.IoManager.Size()
+	if err != nil {
+		return err
+	}
+	if v.Offset >= fileSize {
+		return io.EOF
+	}
+
+	headerBuf, err := v.df.readNBytes(min(maxLogRecordHeaderSize, fileSize-v.Offset), v.Offset)
+	if err != nil {
+		return err
+	}
+	header, headerSize := decodeLogRecordHeader(headerBuf)
+	if header == nil || (header.crc == 0 && header.keySize == 0 && header.valueSize == 0) {
+		return io.EOF
+	}
+
+	// 记录超出文件末尾，可能是写入时崩溃留下的不完整记录
+	size := headerSize + int64(header.keySize) + int64(header.valueSize)
+	if v.Offset+size > fileSize {
+		return ErrInvalidCRC
+	}
+	buf, err := v.df.readNBytes(size, v.Offset)
+	if err != nil {
+		return err
+	}
+	logRecord, err := decodeLogRecord(buf)
+	if err != nil {
+		return err
+	}
+
+	if logRecord.Type == LogRecordFileTrailer {
+		end, sum, ok := DecodeFileTrailer(logRecord.Value)
+		if !ok || end != v.Offset {
+			return ErrInvalidFileChecksum
+		}
+		expected := v.digest.Sum32()
+		if logRecord.Checksum != v.typ {
+			if expected, err = v.df.fileChecksum(logRecord.Checksum, end); err != nil {
+				return err
+			}
+		}
+		if sum != expected {
+			return ErrInvalidFileChecksum
+		}
+	}
+
+	_, _ = v.digest.Write(buf)
+	v.Offset += size
+	return nil
+}
+
+// 写入索引信息到hint文件中，flags与数据文件中对应记录的标志位一致
+func (df *DataFile) WriteHintRecord(key []byte, pos *LogRecordPos, flags LogRecordFlag) error {
+	return df.writeHintRecord(key, pos, LogRecordNormal, flags)
+}
+
+// 写入历史版本的索引信息到hint文件中
+func (df *DataFile) WriteHistoryHintRecord(key []byte, pos *LogRecordPos, flags LogRecordFlag) error {
+	return df.writeHintRecord(key, pos, LogRecordHistory, flags)
+}
+
+func (df *DataFile) writeHintRecord(key []byte, pos *LogRecordPos, typ LogRecordType, flags LogRecordFlag) error {
 	record := &LogRecord{
 		Key:   key,
 		Value: EncodeLogRecordPos(pos),
+		Type:  typ,
+		Flags: flags,
 	}
 
 	encRecord, _ := EncodeLogRecord(record)
@@ -153,12 +421,12 @@ func (df *DataFile) readNBytes(n int64, offset int64) (b []byte, err error) {
 	return
 }
 
-func (df *DataFile) SetIoManager(dirPath string, ioType fio.FileIOType) error {
+func (df *DataFile) SetIoManager(fsys fio.FS, dirPath string, ioType fio.FileIOType) error {
 	if err := df.IoManager.Close(); err != nil {
 		return err
 	}
 
-	ioManager, err := fio.NewIOManager(GetFileName(dirPath, df.FileID), ioType)
+	ioManager, err := fsys.OpenFile(GetFileName(dirPath, df.FileID), ioType)
 	if err != nil {
 		return err
 	}
@@ -2,6 +2,8 @@ package data
 
 import (
 	"bitcask/fio"
+	"fmt"
+	"io"
 	"os"
 	"testing"
 
@@ -9,21 +11,21 @@ import (
 )
 
 func TestOpenDataFile(t *testing.T) {
-	df1, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
+	df1, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df1)
 
-	df2, err := OpenDataFile(os.TempDir(), 1, fio.StandardFIO)
+	df2, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 1, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df2)
 
-	df, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df)
 }
 
 func TestDataFile_Write(t *testing.T) {
-	df, err := OpenDataFile(os.TempDir(), 0, fio.StandardFIO)
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 0, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df)
 
@@ -38,7 +40,7 @@ func TestDataFile_Write(t *testing.T) {
 }
 
 func TestDataFile_Close(t *testing.T) {
-	df, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df)
 
@@ -50,7 +52,7 @@ func TestDataFile_Close(t *testing.T) {
 }
 
 func TestDataFile_Sync(t *testing.T) {
-	df, err := OpenDataFile(os.TempDir(), 111, fio.StandardFIO)
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 111, fio.StandardFIO)
 	assert.Nil(t, err)
 	assert.NotNil(t, df)
 
@@ -62,7 +64,7 @@ func TestDataFile_Sync(t *testing.T) {
 }
 
 func TestDataFile_ReadLogRecord(t *testing.T) {
-	df, err := OpenDataFile(os.TempDir(), 222, fio.StandardFIO)
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 222, fio.StandardFIO)
 	assert.NotNil(t, df)
 	assert.Nil(t, err)
 
@@ -117,3 +119,180 @@ func TestDataFile_ReadLogRecord(t *testing.T) {
 	offset += readSize3
 
 }
+
+func TestReadLogRecordsAt(t *testing.T) {
+	df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 333, fio.IOUringFIO)
+	assert.Nil(t, err)
+	defer os.Remove(GetFileName(os.TempDir(), 333))
+	defer df.Close()
+
+	var positions []*LogRecordPos
+	for i := 0; i < 100; i++ {
+		rec := &LogRecord{Key: []byte(fmt.Sprintf("key-%d", i)), Value: []byte(fmt.Sprintf("value-%d", i))}
+		buf, size := EncodeLogRecord(rec)
+		positions = append(positions, &LogRecordPos{Fid: 333, Offset: df.WriteOff, Size: uint32(size)})
+		err = df.Write(buf)
+		assert.Nil(t, err)
+	}
+	// 没有记录大小时退化为ReadLogRecord，大小错误时校验失败
+	positions = append(positions,
+		&LogRecordPos{Fid: 333, Offset: positions[1].Offset},
+		&LogRecordPos{Fid: 333, Offset: positions[2].Offset, Size: positions[2].Size - 1},
+	)
+
+	files := make([]*DataFile, len(positions))
+	for i := range files {
+		files[i] = df
+	}
+	records, errs := ReadLogRecordsAt(files, positions)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, errs[i])
+		assert.Equal(t, fmt.Sprintf("key-%d", i), string(records[i].Key))
+		assert.Equal(t, fmt.Sprintf("value-%d", i), string(records[i].Value))
+	}
+	assert.Nil(t, errs[100])
+	assert.Equal(t, "value-1", string(records[100].Value))
+	assert.NotNil(t, errs[101])
+}
+
+func TestDataFile_Scanner(t *testing.T) {
+	for _, typ := range []fio.FileIOType{fio.StandardFIO, fio.IOUringFIO} {
+		df, err := OpenDataFile(fio.OSFS{}, os.TempDir(), 444, typ)
+		assert.Nil(t, err)
+
+		// 包含超过一次预读大小的记录
+		var records []*LogRecord
+		var sizes []int64
+		for i := 0; i < 200; i++ {
+			value := []byte(fmt.Sprintf("value-%d", i))
+			if i%50 == 0 {
+				value = make([]byte, scanChunkSize*scanReadAhead+i)
+			}
+			rec := &LogRecord{Key: []byte(fmt.Sprintf("key-%d", i)), Value: value}
+			buf, size := EncodeLogRecord(rec)
+			err = df.Write(buf)
+			assert.Nil(t, err)
+			records = append(records, rec)
+			sizes = append(sizes, size)
+		}
+		// 末尾不完整的记录
+		buf, _ := EncodeLogRecord(&LogRecord{Key: []byte("torn"), Value: []byte("value")})
+		err = df.Write(buf[:len(buf)-2])
+		assert.Nil(t, err)
+
+		scanner, err := df.NewScanner()
+		assert.Nil(t, err)
+		var offset int64
+		for i, rec := range records {
+			assert.Equal(t, offset, scanner.Offset)
+			readRec, size, err := scanner.Next()
+			assert.Nil(t, err)
+			assert.Equal(t, sizes[i], size)
+			assert.Equal(t, rec.Key, readRec.Key)
+			assert.Equal(t, rec.Value, readRec.Value)
+			offset += size
+		}
+		_, _, err = scanner.Next()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Nil(t, df.Close())
+		assert.Nil(t, os.Remove(GetFileName(os.TempDir(), 444)))
+	}
+}
+
+func TestDataFile_Seal(t *testing.T) {
+	fsys := fio.NewMemFS()
+	for _, typ := range []ChecksumType{ChecksumCRC32, ChecksumCRC32C, ChecksumXXH3} {
+		df, err := OpenDataFile(fsys, "/", uint32(typ), fio.StandardFIO)
+		assert.Nil(t, err)
+		df.TrackChecksum(typ)
+
+		var positions []*LogRecordPos
+		for i := 0; i < 100; i++ {
+			rec := &LogRecord{Key: []byte(fmt.Sprintf("key-%d", i)), Value: []byte(fmt.Sprintf("value-%d", i)), Checksum: typ}
+			buf, size := EncodeLogRecord(rec)
+			positions = append(positions, &LogRecordPos{Offset: df.WriteOff, Size: uint32(size)})
+			assert.Nil(t, df.Write(buf))
+		}
+		end := df.WriteOff
+		assert.Nil(t, df.Seal(typ))
+
+		// 尾部校验记录与重新读取文件计算的校验值一致
+		trailer, _, err := df.ReadLogRecord(end)
+		assert.Nil(t, err)
+		assert.Equal(t, LogRecordFileTrailer, trailer.Type)
+		size, sum, ok := DecodeFileTrailer(trailer.Value)
+		assert.True(t, ok)
+		assert.Equal(t, end, size)
+		reopened := &DataFile{IoManager: df.IoManager}
+		expected, err := reopened.fileChecksum(typ, end)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, sum)
+
+		// 校验算法与尾部校验记录不一致时重新读取文件计算
+		for _, verifyType := range []ChecksumType{typ, (typ + 1) % 3} {
+			verifier := df.NewVerifier(verifyType)
+			for err = verifier.Next(); err == nil; err = verifier.Next() {
+			}
+			assert.Equal(t, io.EOF, err)
+			assert.Equal(t, df.WriteOff, verifier.Offset)
+		}
+
+		// 按索引中的大小读取到多条记录
+		files := []*DataFile{df}
+		_, errs := ReadLogRecordsAt(files, []*LogRecordPos{{Offset: positions[3].Offset, Size: positions[3].Size + positions[4].Size}})
+		assert.Equal(t, ErrPositionMismatch, errs[0])
+	}
+}
+
+func TestFileVerifier_Corrupted(t *testing.T) {
+	fsys := fio.NewMemFS()
+	write := func(fid uint32) *DataFile {
+		df, err := OpenDataFile(fsys, "/", fid, fio.StandardFIO)
+		assert.Nil(t, err)
+		df.TrackChecksum(ChecksumCRC32C)
+		for i := 0; i < 10; i++ {
+			buf, _ := EncodeLogRecord(&LogRecord{Key: []byte(fmt.Sprintf("key-%d", i)), Value: []byte("value"), Checksum: ChecksumCRC32C})
+			assert.Nil(t, df.Write(buf))
+		}
+		assert.Nil(t, df.Seal(ChecksumCRC32C))
+		return df
+	}
+	verify := func(df *DataFile) (int64, error) {
+		verifier := df.NewVerifier(ChecksumCRC32C)
+		for {
+			if err := verifier.Next(); err != nil {
+				return verifier.Offset, err
+			}
+		}
+	}
+
+	// 记录中的数据被修改
+	df := write(1)
+	buf, err := fsys.ReadFile(GetFileName("/", 1))
+	assert.Nil(t, err)
+	buf[30] ^= 0xff
+	assert.Nil(t, fsys.WriteFile(GetFileName("/", 1), buf))
+	_, err = verify(df)
+	assert.Equal(t, ErrInvalidCRC, err)
+
+	// 记录本身完整，但尾部校验记录中的校验值与文件内容不一致
+	other, err := OpenDataFile(fsys, "/", 3, fio.StandardFIO)
+	assert.Nil(t, err)
+	buf, _ = EncodeLogRecord(&LogRecord{Key: []byte("other"), Value: []byte("value")})
+	assert.Nil(t, other.Write(buf))
+	trailer, _ := EncodeLogRecord(&LogRecord{
+		Value:    EncodeFileTrailer(int64(len(buf)), 0),
+		Type:     LogRecordFileTrailer,
+		Checksum: ChecksumCRC32C,
+	})
+	assert.Nil(t, other.Write(trailer))
+	offset, err := verify(other)
+	assert.Equal(t, ErrInvalidFileChecksum, err)
+	assert.Equal(t, int64(len(buf)), offset)
+
+	df = write(2)
+	offset, err = verify(df)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, df.WriteOff, offset)
+}
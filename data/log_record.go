@@ -3,6 +3,7 @@ package data
 import (
 	"encoding/binary"
 	"hash/crc32"
+	"io"
 )
 
 type LogRecordType = byte
@@ -11,24 +12,69 @@ const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDeleted
 	LogRecordTxnFinished
+	LogRecordRangeDeleted // 区间删除墓碑，key为区间起点，value为区间终点（不包含）
+	LogRecordHistory      // 仅用于hint文件，表示key的历史版本索引
+	LogRecordFileTrailer  // 数据文件封存时追加的尾部校验记录，value为之前所有数据的长度和校验值
 )
 
-const maxLogRecordHeaderSize = binary.MaxVarintLen32*2 + 5
+// 日志记录标志位
+// v1格式与记录类型编码在同一个字节中：低3位为类型，第3~5位为标志，高2位为校验算法；v2格式使用单独的标志字节
+// 旧版本把整个字节当作类型，读到带标志的删除记录时会当作写入，因此写入过的目录不支持降级
+type LogRecordFlag = byte
+
+const (
+	LogRecordNamespaced LogRecordFlag = 1 << 3 // key中包含命名空间
+	LogRecordVersioned  LogRecordFlag = 1 << 4 // key中的序列号是非事务写入的版本号
+	LogRecordTimestamp  LogRecordFlag = 1 << 5 // header中包含写入时间戳，v2格式总是包含
+	LogRecordExpiry     LogRecordFlag = 1 << 6 // 仅v2格式：header中包含过期时间，当前版本不写入
+)
+
+// 记录的编码格式
+type RecordFormat = byte
+
+const (
+	RecordFormatV1 RecordFormat = iota // 变长header，与旧版本的header布局相同
+	RecordFormatV2                     // 定长header，包含写入时间、过期时间和编码方式
+)
+
+// value的编码方式，例如压缩算法，0表示原始数据。v2格式中占4位，取值为0~15
+// 当前版本只支持CodecNone，读到其他编码方式的记录时返回ErrUnsupportedCodec
+type CodecType = byte
+
+const (
+	CodecNone CodecType = 0
+	maxCodec  CodecType = 0x0F
+)
+
+const logRecordTypeMask = 0x07
+
+// v1格式的类型字段中保留的值，表示记录为v2格式
+const logRecordV2Marker = 0x07
+
+const (
+	maxLogRecordHeaderSizeV1 = binary.MaxVarintLen32*2 + binary.MaxVarintLen64 + 5
+	logRecordHeaderSizeV2    = 4 + 3 + 4*2 + 8 // 不包含可选的过期时间
+	maxLogRecordHeaderSize   = max(maxLogRecordHeaderSizeV1, logRecordHeaderSizeV2+8)
+)
 
 // 数据内存索引，主要是描述数据在磁盘上的位置
 type LogRecordPos struct {
-	Fid    uint32 // 文件id，表示将数据存储到哪个文件中
-	Offset int64  // 数据存储位置在文件中的偏移量
-	Size   uint32 // 数据在磁盘上的大小
+	Fid       uint32 // 文件id，表示将数据存储到哪个文件中
+	Offset    int64  // 数据存储位置在文件中的偏移量
+	Size      uint32 // 数据在磁盘上的大小
+	Version   uint64 // 写入该记录时分配的序列号
+	Timestamp int64  // 写入该记录的时间（纳秒），为0表示未记录
 }
 
 // 对索引位置进行编码
 func EncodeLogRecordPos(pos *LogRecordPos) []byte {
-	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64) // Fid: uint32, Offset: int64
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64*3) // Fid: uint32, Offset: int64, Version: uint64, Timestamp: int64
 	var index = 0
 	index += binary.PutVarint(buf[index:], int64(pos.Fid))
 	index += binary.PutVarint(buf[index:], pos.Offset)
 	index += binary.PutVarint(buf[index:], int64(pos.Size))
+	index += binary.PutUvarint(buf[index:], pos.Version)
+	index += binary.PutVarint(buf[index:], pos.Timestamp)
 
 	return buf[:index]
 }
@@ -40,27 +86,48 @@ func DecodeLogRecordPos(buf []byte) *LogRecordPos {
 	index += n
 	offset, n := binary.Varint(buf[index:])
 	index += n
-	size, _ := binary.Varint(buf[index:])
+	size, n := binary.Varint(buf[index:])
+	index += n
+	// 旧版本编码中没有版本号和时间戳，此时解码结果为0
+	version, n := binary.Uvarint(buf[index:])
+	index += n
+	timestamp, _ := binary.Varint(buf[index:])
 
 	return &LogRecordPos{
-		Fid:    uint32(fileId),
-		Offset: offset,
-		Size:   uint32(size),
+		Fid:       uint32(fileId),
+		Offset:    offset,
+		Size:      uint32(size),
+		Version:   version,
+		Timestamp: timestamp,
 	}
 }
 
 // 写入到数据文件的记录
 type LogRecord struct {
-	Key   []byte
-	Value []byte
-	Type  LogRecordType
+	Key       []byte
+	Value     []byte
+	Type      LogRecordType
+	Flags     LogRecordFlag
+	Timestamp int64        // 写入时间（纳秒），v1格式不为0时编码到header中
+	Checksum  ChecksumType // 记录使用的校验算法
+	Format    RecordFormat // 编码格式
+
+	// v2格式预留的字段，引擎还不支持过期和value编码，不对外暴露
+	expiry int64     // 过期时间（纳秒），为0表示不过期
+	codec  CodecType // value的编码方式
 }
 
 type logRecordHeader struct {
 	crc           uint32
 	logRecordType LogRecordType
+	flags         LogRecordFlag
+	checksum      ChecksumType
+	format        RecordFormat
+	codec         CodecType
 	keySize       uint32
 	valueSize     uint32
+	timestamp     int64
+	expiry        int64
 }
 
 // 暂存事务相关的数据
@@ -71,15 +138,25 @@ type TxnRecord struct {
 
 // 将LogRecord编码为字节数组，返回数组长度
 //
-//	|  crc  |  type  |  keySize  |  valueSize  |  key  |  value  |
+// v1:	|  crc  |  type + flags + checksum  |  keySize  |  valueSize  |  timestamp（可选）  |  key  |  value  |
+//
+// v2:	|  crc  |  7 + checksum  |  type + codec  |  flags  |  keySize  |  valueSize  |  timestamp  |  expiry（可选）  |  key  |  value  |
+//
+// v2格式的header定长：type和codec各占半个字节，keySize和valueSize为4字节，时间均为8字节，整数都是小端序
+// 保留位写入时为0，读取时忽略：第5个字节的第3~5位，type的6~15，flags的第0~2位和第7位
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
+	// codec只有4位，超出范围会破坏type
+	if logRecord.codec > maxCodec {
+		panic("unsupported log record codec")
+	}
 	header := make([]byte, maxLogRecordHeaderSize)
 
-	header[4] = logRecord.Type
-	var index = 5
-
-	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
-	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+	var index int
+	if logRecord.Format == RecordFormatV2 || logRecord.expiry != 0 || logRecord.codec != CodecNone {
+		index = encodeLogRecordHeaderV2(header, logRecord)
+	} else {
+		index = encodeLogRecordHeaderV1(header, logRecord)
+	}
 
 	size := index + len(logRecord.Key) + len(logRecord.Value)
 	encBytes := make([]byte, size)
@@ -88,7 +165,7 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	copy(encBytes[index:], logRecord.Key)
 	copy(encBytes[index+len(logRecord.Key):], logRecord.Value)
 
-	crc := crc32.ChecksumIEEE(encBytes[4:])
+	crc := checksum(logRecord.Checksum, encBytes[4:])
 	binary.LittleEndian.PutUint32(encBytes[:4], crc)
 
 	// fmt.Printf("header length: %d, crc: %d\n", index, crc)
@@ -96,38 +173,184 @@ func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
 	return encBytes, int64(size)
 }
 
+// 编码v1格式的header（不包含crc），返回header长度
+func encodeLogRecordHeaderV1(header []byte, logRecord *LogRecord) int {
+	// 时间戳标志位由Timestamp是否为0决定
+	flags := logRecord.Flags &^ (LogRecordTimestamp | LogRecordExpiry | checksumMask)
+	if logRecord.Timestamp != 0 {
+		flags |= LogRecordTimestamp
+	}
+	header[4] = logRecord.Type | flags | logRecord.Checksum<<checksumShift
+	var index = 5
+
+	index += binary.PutVarint(header[index:], int64(len(logRecord.Key)))
+	index += binary.PutVarint(header[index:], int64(len(logRecord.Value)))
+	if logRecord.Timestamp != 0 {
+		index += binary.PutVarint(header[index:], logRecord.Timestamp)
+	}
+	return index
+}
+
+// 编码v2格式的header（不包含crc），返回header长度
+func encodeLogRecordHeaderV2(header []byte, logRecord *LogRecord) int {
+	// 过期时间标志位由expiry是否为0决定
+	flags := logRecord.Flags&^LogRecordExpiry | LogRecordTimestamp
+	if logRecord.expiry != 0 {
+		flags |= LogRecordExpiry
+	}
+	header[4] = logRecordV2Marker | logRecord.Checksum<<checksumShift
+	header[5] = logRecord.Type | logRecord.codec<<4
+	header[6] = flags
+	binary.LittleEndian.PutUint32(header[7:], uint32(len(logRecord.Key)))
+	binary.LittleEndian.PutUint32(header[11:], uint32(len(logRecord.Value)))
+	binary.LittleEndian.PutUint64(header[15:], uint64(logRecord.Timestamp))
+	var index = logRecordHeaderSizeV2
+
+	if logRecord.expiry != 0 {
+		binary.LittleEndian.PutUint64(header[index:], uint64(logRecord.expiry))
+		index += 8
+	}
+	return index
+}
+
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	if len(buf) <= 4 {
 		return nil, 0
 	}
+	if buf[4]&logRecordTypeMask == logRecordV2Marker {
+		return decodeLogRecordHeaderV2(buf)
+	}
 
 	header := &logRecordHeader{
 		crc:           binary.LittleEndian.Uint32(buf[:4]),
-		logRecordType: buf[4],
+		logRecordType: buf[4] & logRecordTypeMask,
+		flags:         buf[4] &^ (logRecordTypeMask | checksumMask),
+		checksum:      buf[4] >> checksumShift,
+		format:        RecordFormatV1,
 	}
 
+	// 写入时崩溃可能只留下部分header，与读到文件末尾的情况相同
 	var index = 5
 	keySize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	index += n
 	valueSize, n := binary.Varint(buf[index:])
+	if n <= 0 {
+		return nil, 0
+	}
 	index += n
+	if header.flags&LogRecordTimestamp != 0 {
+		timestamp, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			return nil, 0
+		}
+		header.timestamp = timestamp
+		index += n
+	}
 
 	header.keySize, header.valueSize = uint32(keySize), uint32(valueSize)
 
 	return header, int64(index)
 }
 
+func decodeLogRecordHeaderV2(buf []byte) (*logRecordHeader, int64) {
+	// 写入时崩溃可能只留下部分header，与读到文件末尾的情况相同
+	if len(buf) < logRecordHeaderSizeV2 {
+		return nil, 0
+	}
+
+	header := &logRecordHeader{
+		crc:           binary.LittleEndian.Uint32(buf[:4]),
+		checksum:      buf[4] >> checksumShift,
+		format:        RecordFormatV2,
+		logRecordType: buf[5] & 0x0F,
+		codec:         buf[5] >> 4,
+		flags:         buf[6],
+		keySize:       binary.LittleEndian.Uint32(buf[7:]),
+		valueSize:     binary.LittleEndian.Uint32(buf[11:]),
+		timestamp:     int64(binary.LittleEndian.Uint64(buf[15:])),
+	}
+
+	var index = logRecordHeaderSizeV2
+	if header.flags&LogRecordExpiry != 0 {
+		if len(buf) < index+8 {
+			return nil, 0
+		}
+		header.expiry = int64(binary.LittleEndian.Uint64(buf[index:]))
+		index += 8
+	}
+
+	return header, int64(index)
+}
+
+// 从完整的记录中解码LogRecord并校验crc
+func decodeLogRecord(buf []byte) (*LogRecord, error) {
+	header, headerSize := decodeLogRecordHeader(buf)
+	if header == nil {
+		return nil, io.EOF
+	}
+	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
+		return nil, io.EOF
+	}
+
+	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
+	size := headerSize + keySize + valueSize
+	if size > int64(len(buf)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if !ValidChecksum(header.checksum) || checksum(header.checksum, buf[crc32.Size:size]) != header.crc {
+		return nil, ErrInvalidCRC
+	}
+	if header.codec != CodecNone {
+		return nil, ErrUnsupportedCodec
+	}
+	// buf按索引中记录的大小读取，大小不一致说明读取的位置不是索引指向的记录
+	if size != int64(len(buf)) {
+		return nil, ErrPositionMismatch
+	}
+
+	return &LogRecord{
+		Key:       buf[headerSize : headerSize+keySize],
+		Value:     buf[headerSize+keySize : size],
+		Type:      header.logRecordType,
+		Flags:     header.flags,
+		Timestamp: header.timestamp,
+		Checksum:  header.checksum,
+		Format:    header.format,
+		expiry:    header.expiry,
+	}, nil
+}
+
 func getLogRecordCRC(lr *LogRecord, header []byte) uint32 {
 	if lr == nil {
 		return 0
 	}
 
-	// 重要
-	encBytes := make([]byte, len(header)+len(lr.Key)+len(lr.Value))
+	digest := newChecksumDigest(lr.Checksum)
+	_, _ = digest.Write(header)
+	_, _ = digest.Write(lr.Key)
+	_, _ = digest.Write(lr.Value)
 
-	copy(encBytes[:len(header)], header)
-	copy(encBytes[len(header):], lr.Key)
-	copy(encBytes[len(header)+len(lr.Key):], lr.Value)
+	return digest.Sum32()
+}
 
-	return crc32.ChecksumIEEE(encBytes)
+// 对尾部校验记录的value进行编码：之前所有数据的长度和校验值
+//
+//	|  size（varint）  |  checksum（4字节小端序）  |
+func EncodeFileTrailer(size int64, sum uint32) []byte {
+	buf := make([]byte, binary.MaxVarintLen64+crc32.Size)
+	index := binary.PutVarint(buf, size)
+	binary.LittleEndian.PutUint32(buf[index:], sum)
+	return buf[:index+crc32.Size]
+}
+
+// 解码尾部校验记录的value
+func DecodeFileTrailer(buf []byte) (int64, uint32, bool) {
+	size, n := binary.Varint(buf)
+	if n <= 0 || len(buf) != n+crc32.Size {
+		return 0, 0, false
+	}
+	return size, binary.LittleEndian.Uint32(buf[n:]), true
 }
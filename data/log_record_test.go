@@ -1,7 +1,11 @@
 package data
 
 import (
+	"bitcask/fio"
+	"encoding/binary"
+	"fmt"
 	"hash/crc32"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -93,3 +97,161 @@ func TestGetLogRecordCRC(t *testing.T) {
 	t.Log(crc2)
 	assert.Equal(t, crc2, uint32(240712713))
 }
+
+func TestEncodeLogRecordPos(t *testing.T) {
+	pos := &LogRecordPos{Fid: 1, Offset: 100, Size: 24, Version: 1024}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+
+	// 兼容没有版本号的旧编码
+	buf := make([]byte, binary.MaxVarintLen64*3)
+	n := binary.PutVarint(buf, 1)
+	n += binary.PutVarint(buf[n:], 100)
+	n += binary.PutVarint(buf[n:], 24)
+	assert.Equal(t, &LogRecordPos{Fid: 1, Offset: 100, Size: 24}, DecodeLogRecordPos(buf[:n]))
+}
+
+func TestEncodeLogRecord_Timestamp(t *testing.T) {
+	rec := &LogRecord{
+		Key:       []byte("name"),
+		Value:     []byte("bitcask-go"),
+		Type:      LogRecordNormal,
+		Timestamp: 1700000000000000000,
+	}
+	res, size := EncodeLogRecord(rec)
+	assert.Equal(t, LogRecordTimestamp, res[4]&LogRecordTimestamp)
+
+	header, headerSize := decodeLogRecordHeader(res)
+	assert.Equal(t, rec.Timestamp, header.timestamp)
+	assert.Equal(t, size, headerSize+int64(len(rec.Key)+len(rec.Value)))
+	assert.Equal(t, header.crc, getLogRecordCRC(rec, res[crc32.Size:headerSize]))
+}
+
+func TestEncodeLogRecord_Checksum(t *testing.T) {
+	for _, typ := range []ChecksumType{ChecksumCRC32, ChecksumCRC32C, ChecksumXXH3} {
+		rec := &LogRecord{
+			Key:      []byte("name"),
+			Value:    []byte("bitcask-go"),
+			Type:     LogRecordNormal,
+			Flags:    LogRecordNamespaced,
+			Checksum: typ,
+		}
+		res, _ := EncodeLogRecord(rec)
+		decoded, err := decodeLogRecord(res)
+		assert.Nil(t, err)
+		assert.Equal(t, rec, decoded)
+
+		header, headerSize := decodeLogRecordHeader(res)
+		assert.Equal(t, typ, header.checksum)
+		assert.Equal(t, LogRecordNamespaced, header.flags)
+		assert.Equal(t, header.crc, getLogRecordCRC(rec, res[crc32.Size:headerSize]))
+	}
+
+	// 默认算法与旧版本的编码一致
+	rec := &LogRecord{Key: []byte("name"), Value: []byte("bitcask-go")}
+	res, _ := EncodeLogRecord(rec)
+	assert.Equal(t, crc32.ChecksumIEEE(res[crc32.Size:]), binary.LittleEndian.Uint32(res[:crc32.Size]))
+
+	// 无法识别的校验算法
+	res[4] |= checksumMask
+	_, err := decodeLogRecord(res)
+	assert.Equal(t, ErrInvalidCRC, err)
+
+	// 只写入了部分header
+	res, _ = EncodeLogRecord(rec)
+	header, _ := decodeLogRecordHeader(res[:5])
+	assert.Nil(t, header)
+}
+
+func TestEncodeFileTrailer(t *testing.T) {
+	size, sum, ok := DecodeFileTrailer(EncodeFileTrailer(4096, 123456))
+	assert.True(t, ok)
+	assert.Equal(t, int64(4096), size)
+	assert.Equal(t, uint32(123456), sum)
+
+	_, _, ok = DecodeFileTrailer([]byte{1, 2})
+	assert.False(t, ok)
+}
+
+func TestEncodeLogRecord_V2(t *testing.T) {
+	rec := &LogRecord{
+		Key:       []byte("name"),
+		Value:     []byte("bitcask-go"),
+		Type:      LogRecordDeleted,
+		Flags:     LogRecordNamespaced | LogRecordTimestamp,
+		Timestamp: 1700000000000000000,
+		Checksum:  ChecksumCRC32C,
+		Format:    RecordFormatV2,
+	}
+	res, size := EncodeLogRecord(rec)
+	assert.Equal(t, int64(logRecordHeaderSizeV2+len(rec.Key)+len(rec.Value)), size)
+	decoded, err := decodeLogRecord(res)
+	assert.Nil(t, err)
+	assert.Equal(t, rec, decoded)
+
+	// 设置过期时间或编码方式时总是使用v2格式
+	rec = &LogRecord{
+		Key:    []byte("name"),
+		Value:  []byte("bitcask-go"),
+		expiry: 1800000000000000000,
+		codec:  3,
+	}
+	res, size = EncodeLogRecord(rec)
+	assert.Equal(t, int64(logRecordHeaderSizeV2+8+len(rec.Key)+len(rec.Value)), size)
+	header, headerSize := decodeLogRecordHeader(res)
+	assert.Equal(t, RecordFormatV2, header.format)
+	assert.Equal(t, LogRecordExpiry|LogRecordTimestamp, header.flags)
+	assert.Equal(t, CodecType(3), header.codec)
+	assert.Equal(t, rec.expiry, header.expiry)
+	assert.Equal(t, int64(0), header.timestamp)
+	assert.Equal(t, header.crc, getLogRecordCRC(rec, res[crc32.Size:headerSize]))
+
+	// 不支持的编码方式
+	_, err = decodeLogRecord(res)
+	assert.Equal(t, ErrUnsupportedCodec, err)
+	df, err := OpenDataFile(fio.NewMemFS(), "/", 1, fio.StandardFIO)
+	assert.Nil(t, err)
+	assert.Nil(t, df.Write(res))
+	_, _, err = df.ReadLogRecord(0)
+	assert.Equal(t, ErrUnsupportedCodec, err)
+
+	// 只有过期时间时可以读取，编码方式超出范围时拒绝编码
+	rec.codec = CodecNone
+	res, _ = EncodeLogRecord(rec)
+	decoded, err = decodeLogRecord(res)
+	assert.Nil(t, err)
+	assert.Equal(t, rec.expiry, decoded.expiry)
+	rec.codec = maxCodec + 1
+	assert.Panics(t, func() { EncodeLogRecord(rec) })
+
+	// 只写入了部分header
+	header, _ = decodeLogRecordHeader(res[:logRecordHeaderSizeV2])
+	assert.Nil(t, header)
+	header, _ = decodeLogRecordHeader(res[:10])
+	assert.Nil(t, header)
+}
+
+func TestReadLogRecord_MixedFormat(t *testing.T) {
+	df, err := OpenDataFile(fio.NewMemFS(), "/", 1, fio.StandardFIO)
+	assert.Nil(t, err)
+
+	var records []*LogRecord
+	for i := 0; i < 10; i++ {
+		rec := &LogRecord{Key: []byte(fmt.Sprintf("key-%d", i)), Value: []byte(fmt.Sprintf("value-%d", i))}
+		if i%2 == 1 {
+			rec.Format, rec.Flags, rec.Timestamp = RecordFormatV2, LogRecordTimestamp, int64(i)
+		}
+		buf, _ := EncodeLogRecord(rec)
+		assert.Nil(t, df.Write(buf))
+		records = append(records, rec)
+	}
+
+	var offset int64
+	for _, rec := range records {
+		readRec, size, err := df.ReadLogRecord(offset)
+		assert.Nil(t, err)
+		assert.Equal(t, rec, readRec)
+		offset += size
+	}
+	_, _, err = df.ReadLogRecord(offset)
+	assert.Equal(t, io.EOF, err)
+}
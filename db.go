@@ -4,7 +4,8 @@ import (
 	"bitcask/data"
 	"bitcask/fio"
 	"bitcask/index"
-	"bitcask/utils"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,30 +15,36 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-
-	"github.com/gofrs/flock"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	seqNoKey     = "seq.no"
-	fileLockName = "flock"
+	seqNoKey       = "seq.no"
+	fileLockName   = "flock"
+	readerLockName = "flock-reader" // 只读进程持有共享锁，写进程替换数据文件时需要获取排他锁
 )
 
 // 存储引擎实例
 type DB struct {
-	opt             Options
-	mu              *sync.RWMutex
-	fileIds         []int                     // 仅用于加载索引
-	activeFile      *data.DataFile            // 当前活跃文件，用于写入
-	olderFiles      map[uint32]*data.DataFile // 旧的数据文件，只用于读
-	index           index.Indexer
-	seqNo           uint64       // 事务序列号，全局递增
-	isMerging       bool         // 数据库是否正在执行merge操作
-	seqNoFileExists bool         // 存储事务序列号的文件是否存在
-	isInitial       bool         // 是否第一次初始化数据目录
-	fileLock        *flock.Flock // 文件锁，保证数据目录只被单进程使用
-	bytesWrite      uint         // 当前活跃文件的累计写入字节数
-	reclaimSize     int64        // 表示有多少数据是无效的
+	opt         Options
+	mu          *sync.RWMutex
+	fileIds     []int                     // 仅用于加载索引
+	activeFile  *data.DataFile            // 当前活跃文件，用于写入
+	olderFiles  map[uint32]*data.DataFile // 旧的数据文件，只用于读
+	index       index.Indexer
+	seqNo       uint64                          // 序列号，全局递增，每次写入都会分配
+	isMerging   bool                            // 数据库是否正在执行merge操作
+	isInitial   bool                            // 是否第一次初始化数据目录
+	lastMerge   int64                           // 最近一次应用merge的时间
+	fileLock    fio.FileLock                    // 文件锁，保证数据目录只被单进程使用
+	bytesWrite  uint                            // 当前活跃文件的累计写入字节数
+	reclaimSize int64                           // 表示有多少数据是无效的
+	namespaces  map[string]*Namespace           // 命名空间，共用日志文件，拥有独立的内存索引
+	history     map[string][]*data.LogRecordPos // 历史版本模式下每个key的旧版本位置，按版本号从小到大排列
+	historyRefs map[historyRef]map[string]bool  // 旧版本位置到引用它的key，区间删除墓碑可能被多个key引用
+	pendingTxns map[uint64][]*data.TxnRecord    // 暂存尚未读到事务完成记录的事务数据，只读模式下在Refresh之间保留
+	corruptions []Corruption                    // 最近一次Verify发现的数据损坏
 }
 
 // 存储引擎统计信息
@@ -46,6 +53,9 @@ type Stat struct {
 	DataFileNum uint  // 数据文件数量
 	ReclaimSize int64 // 可以进行merge回收的数据量（B）
 	DiskSize    int64 // 数据目录所占磁盘空间大小
+
+	// 最近一次Verify发现的数据损坏，为空表示未发现损坏或未执行过校验
+	Corruptions []Corruption
 }
 
 // 打开存储引擎实例
@@ -54,18 +64,30 @@ func OpenDB(opt Options) (*DB, error) {
 	if err := checkOptions(opt); err != nil {
 		return nil, err
 	}
+	opt.FS = opt.fileSystem()
+
+	// 只读模式不创建任何文件，只获取共享锁
+	if opt.ReadOnly {
+		if _, err := opt.FS.Stat(opt.DirPath); err != nil {
+			return nil, err
+		}
+		// 写进程打开过之后才有共享锁文件，没有时说明还没有写进程会替换数据文件，不加锁
+		readerLockPath := filepath.Join(opt.DirPath, readerLockName)
+		if _, err := opt.FS.Stat(readerLockPath); os.IsNotExist(err) {
+			return openDB(opt, noLock{})
+		}
+		return openDB(opt, opt.FS.NewLock(readerLockPath))
+	}
 
-	var isInitial bool = false
 	// 检查数据目录是否存在
-	if _, err := os.Stat(opt.DirPath); os.IsNotExist(err) {
-		isInitial = true
-		if err := os.MkdirAll(opt.DirPath, os.ModePerm); err != nil {
+	if _, err := opt.FS.Stat(opt.DirPath); os.IsNotExist(err) {
+		if err := opt.FS.MkdirAll(opt.DirPath); err != nil {
 			return nil, err
 		}
 	}
 
 	// 判断数据目录是否正在被使用
-	fileLock := flock.New(filepath.Join(opt.DirPath, fileLockName))
+	fileLock := opt.FS.NewLock(filepath.Join(opt.DirPath, fileLockName))
 	hold, err := fileLock.TryLock()
 	if err != nil {
 		return nil, err
@@ -74,36 +96,104 @@ func OpenDB(opt Options) (*DB, error) {
 		return nil, ErrDatabaseIsUsing
 	}
 
-	entries, err := os.ReadDir(opt.DirPath)
-	if err != nil {
+	// 为只读进程创建共享锁文件，只读进程自身不创建文件
+	if err := createReaderLockFile(opt.FS, opt.DirPath); err != nil {
+		_ = fileLock.Unlock()
 		return nil, err
 	}
 
-	if len(entries) == 0 {
-		isInitial = true
+	return openDB(opt, fileLock)
+}
+
+func createReaderLockFile(fsys fio.FS, dirPath string) error {
+	fileName := filepath.Join(dirPath, readerLockName)
+	if _, err := fsys.Stat(fileName); !os.IsNotExist(err) {
+		return err
+	}
+	file, err := fsys.OpenFile(fileName, fio.StandardFIO)
+	if err != nil {
+		return err
 	}
+	return file.Close()
+}
 
-	// 初始化DB实例结构体
-	db := &DB{
-		opt:        opt,
-		mu:         new(sync.RWMutex),
-		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(opt.IndexType, opt.DirPath, opt.SyncWrites),
-		isMerging:  false,
-		isInitial:  isInitial,
-		fileLock:   fileLock,
+// 数据目录中没有共享锁文件时只读进程使用的空锁
+type noLock struct{}
+
+func (noLock) TryLock() (bool, error) { return true, nil }
+
+func (noLock) RLock() error { return nil }
+
+func (noLock) Unlock() error { return nil }
+
+func openDB(opt Options, fileLock fio.FileLock) (*DB, error) {
+	// 只读进程等待写进程替换完数据文件
+	if opt.ReadOnly {
+		if err := fileLock.RLock(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 检查目录的元数据与配置是否兼容，索引类型不一致时需要先迁移索引
+	m, err := checkManifest(opt)
+	if err != nil {
+		_ = fileLock.Unlock()
+		return nil, err
 	}
 
-	// 加载merge数据目录
-	if err := db.loadMergeFiles(); err != nil {
+	// 没有元数据也没有数据文件，说明是第一次初始化数据目录
+	fileIds, err := listDataFileIds(opt.FS, opt.DirPath)
+	if err != nil {
+		_ = fileLock.Unlock()
 		return nil, err
 	}
+	isInitial := m == nil && len(fileIds) == 0
+
+	// 初始化DB实例结构体
+	db := &DB{
+		opt:         opt,
+		mu:          new(sync.RWMutex),
+		olderFiles:  make(map[uint32]*data.DataFile),
+		index:       index.NewIndexer(opt.IndexType, opt.DirPath, opt.SyncWrites),
+		namespaces:  make(map[string]*Namespace),
+		history:     make(map[string][]*data.LogRecordPos),
+		historyRefs: make(map[historyRef]map[string]bool),
+		pendingTxns: make(map[uint64][]*data.TxnRecord),
+		isMerging:   false,
+		isInitial:   isInitial,
+		fileLock:    fileLock,
+	}
+	if m != nil {
+		db.lastMerge = m.LastMerge
+	}
+
+	// 加载merge数据目录，只读模式不替换数据文件
+	if !opt.ReadOnly {
+		if err := db.loadMergeFiles(); err != nil {
+			return nil, err
+		}
+	}
 
 	// 加载数据文件
 	if err := db.loadDataFiles(); err != nil {
 		return nil, err
 	}
 
+	// 检查数据文件是否有缺失或多余，merge可能更新了元数据，需要重新读取
+	if m != nil {
+		if m, err = readManifest(opt.FS, opt.DirPath); err != nil {
+			return nil, err
+		}
+		if err := checkManifestFiles(m, db.fileIds); err != nil {
+			if db.activeFile != nil {
+				_ = db.closeDataFiles()
+			}
+			_ = db.index.Close()
+			_ = fileLock.Unlock()
+			return nil, err
+		}
+	}
+
 	// B+树不需要从数据文件中加载索引
 	if opt.IndexType != BPlusTree {
 		// 从hint文件中加载索引
@@ -121,13 +211,13 @@ func OpenDB(opt Options) (*DB, error) {
 			return nil, err
 		}
 
-		// 手动更新活跃文件偏移量
+		// 手动更新活跃文件偏移量，文件末尾可能是没有截掉的预分配空间
 		if db.activeFile != nil {
-			size, err := db.activeFile.IoManager.Size()
+			offset, err := dataFileEnd(db.activeFile)
 			if err != nil {
 				return nil, err
 			}
-			db.activeFile.WriteOff = size
+			db.activeFile.WriteOff = offset
 		}
 	}
 
@@ -135,6 +225,26 @@ func OpenDB(opt Options) (*DB, error) {
 		return nil, err
 	}
 
+	// 异常退出时活跃文件末尾可能留有预分配的空间，截掉之后才能继续追加写
+	if !opt.ReadOnly && db.activeFile != nil {
+		size, err := db.activeFile.IoManager.Size()
+		if err != nil {
+			return nil, err
+		}
+		if size > db.activeFile.WriteOff {
+			if err := db.activeFile.IoManager.Truncate(db.activeFile.WriteOff); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 记录目录的元数据
+	if !opt.ReadOnly {
+		if err := db.saveManifest(); err != nil {
+			return nil, err
+		}
+	}
+
 	return db, nil
 }
 
@@ -148,7 +258,7 @@ func (db *DB) Stat() *Stat {
 		dataFileNum++
 	}
 
-	diskSize, err := utils.DirSize(db.opt.DirPath)
+	diskSize, err := fio.DirSize(db.opt.FS, db.opt.DirPath)
 	if err != nil {
 		panic(fmt.Sprintf("failed to get dir size: %v", err))
 	}
@@ -158,21 +268,22 @@ func (db *DB) Stat() *Stat {
 		DataFileNum: dataFileNum,
 		ReclaimSize: db.reclaimSize,
 		DiskSize:    diskSize,
+		Corruptions: append([]Corruption(nil), db.corruptions...),
 	}
 }
 
-// 将数据文件的IOManager设置为标准文件IO
+// 将数据文件的IOManager设置为运行时使用的IO类型
 func (db *DB) resetIoType() error {
 	if db.activeFile == nil {
 		return nil
 	}
 
-	if err := db.activeFile.SetIoManager(db.opt.DirPath, fio.StandardFIO); err != nil {
+	if err := db.activeFile.SetIoManager(db.opt.FS, db.opt.DirPath, db.ioType()); err != nil {
 		return err
 	}
 
 	for _, dataFile := range db.olderFiles {
-		if err := dataFile.SetIoManager(db.opt.DirPath, fio.StandardFIO); err != nil {
+		if err := dataFile.SetIoManager(db.opt.FS, db.opt.DirPath, db.olderFileIoType()); err != nil {
 			return err
 		}
 	}
@@ -180,12 +291,35 @@ func (db *DB) resetIoType() error {
 	return nil
 }
 
+// 旧的数据文件使用的IO类型，写缓冲和直接IO只对写入有效，旧的数据文件使用标准文件IO
+func (db *DB) olderFileIoType() fio.FileIOType {
+	if db.opt.MMapOlderFiles {
+		return fio.MemoryMap
+	}
+	if typ := db.ioType(); typ == fio.BufferedFIO || typ == fio.DirectFIO {
+		return fio.StandardFIO
+	}
+	return db.ioType()
+}
+
+// 运行时数据文件使用的IO类型，只读模式不能修改文件，总是使用标准文件IO
+func (db *DB) ioType() fio.FileIOType {
+	if db.opt.ReadOnly {
+		return fio.StandardFIO
+	}
+	return db.opt.IOType
+}
+
 func (db *DB) loadSeqNo() error {
 	seqNoPath := filepath.Join(db.opt.DirPath, data.SeqNoFileName)
-	if _, err := os.Stat(seqNoPath); os.IsNotExist(err) {
-		return nil
+	if _, err := db.opt.FS.Stat(seqNoPath); os.IsNotExist(err) {
+		// 没有正常关闭或者刚迁移过来，从数据文件中恢复序列号
+		if db.isInitial {
+			return nil
+		}
+		return db.scanSeqNo()
 	}
-	seqNoFile, err := data.OpenSeqNoFile(db.opt.DirPath)
+	seqNoFile, err := data.OpenSeqNoFile(db.opt.FS, db.opt.DirPath)
 	if err != nil {
 		return err
 	}
@@ -200,33 +334,44 @@ func (db *DB) loadSeqNo() error {
 		return err
 	}
 	db.seqNo = uint64(seqNo)
-	db.seqNoFileExists = true
 
 	// 重要！！否则一直追加写seqNoFile记录
-	return os.Remove(seqNoPath)
+	return db.opt.FS.Remove(seqNoPath)
 }
 
 // 备份数据库，将数据文件拷贝到新的目录中
 func (db *DB) BackUp(dir string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
-	return utils.CopyDir(db.opt.DirPath, dir, []string{fileLockName}) // 排除文件锁
+	return db.BackUpCtx(context.Background(), dir)
 }
 
 func (db *DB) Put(key []byte, value []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
 
+	// 写日志和更新索引在同一把锁内完成，保证条件写操作的原子性
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.put(key, value)
+}
+
+// 写入数据并更新内存索引
+// 访问此方法前必须持有互斥锁
+func (db *DB) put(key []byte, value []byte) error {
 	// 构造LogRecord结构体
 	logRecord := data.LogRecord{
-		Key:   logRecordKeyWithSeqNo(key, nonTransactionSeqNo),
+		Key:   logRecordKeyWithSeqNo(key, db.nextSeqNo()),
 		Value: value,
 		Type:  data.LogRecordNormal,
+		Flags: data.LogRecordVersioned,
 	}
 
-	pos, err := db.appendLogRecordWithLock(&logRecord)
+	pos, err := db.appendLogRecord(&logRecord)
 	if err != nil {
 		return err
 	}
@@ -234,11 +379,29 @@ func (db *DB) Put(key []byte, value []byte) error {
 	// 更新内存索引
 	if oldPos := db.index.Put(key, pos); oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
+		db.addHistory(nil, key, oldPos)
 	}
 
 	return nil
 }
 
+// 获取key的值以及写入该值时分配的版本号
+func (db *DB) GetWithVersion(key []byte) ([]byte, uint64, error) {
+	if len(key) == 0 {
+		return nil, 0, ErrKeyIsEmpty
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	pos := db.index.Get(key)
+	value, err := db.getValueByPosition(pos)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, pos.Version, nil
+}
+
 func (db *DB) Get(key []byte) ([]byte, error) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -253,25 +416,37 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 
 // 获取数据库中所有key
 func (db *DB) ListKeys() [][]byte {
-	it := db.index.Iterator(false)
+	return listKeys(db.index)
+}
+
+func listKeys(idx index.Indexer) [][]byte {
+	it := idx.Iterator(false)
 	defer it.Close()
-	keys := make([][]byte, db.index.Size())
-	var idx int
+	keys := make([][]byte, 0, idx.Size())
 	for it.Rewind(); it.Valid(); it.Next() {
-		keys[idx] = it.Key()
-		idx++
+		// B+树迭代器返回的key指向事务内存，事务结束后会被覆盖
+		keys = append(keys, append([]byte(nil), it.Key()...))
 	}
 	return keys
 }
 
 // 获取所有数据，并执行用户指定操作，直到操作返回false推出循环
 func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
-	db.mu.RLock()
+	return db.FoldCtx(context.Background(), fn)
+}
+
+func (db *DB) fold(ctx context.Context, idx index.Indexer, fn func(key []byte, value []byte) bool) error {
+	if err := db.rlockCtx(ctx); err != nil {
+		return err
+	}
 	defer db.mu.RUnlock()
 
-	it := db.index.Iterator(false)
+	it := idx.Iterator(false)
 	defer it.Close() // B+树读写事务之间是互斥的
 	for it.Rewind(); it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		val, err := db.getValueByPosition(it.Value())
 		if err != nil {
 			return err
@@ -304,12 +479,68 @@ func (db *DB) Close() error {
 	if err := db.index.Close(); err != nil {
 		return err
 	}
+	for _, ns := range db.namespaces {
+		if err := ns.index.Close(); err != nil {
+			return err
+		}
+	}
+
+	// 只读模式不写入任何文件
+	if db.opt.ReadOnly {
+		return db.closeDataFiles()
+	}
 
 	// 为了BPlusTree，保存当前事务序列号
-	seqNoFile, err := data.OpenSeqNoFile(db.opt.DirPath)
+	if err := db.saveSeqNo(db.opt.DirPath); err != nil {
+		return err
+	}
+	if err := db.saveManifest(); err != nil {
+		return err
+	}
+
+	return db.closeDataFiles()
+}
+
+// 遍历hint文件和数据文件，取得最大的序列号
+func (db *DB) scanSeqNo() error {
+	seqNo, err := maxHintSeqNo(db.opt.FS, db.opt.DirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, fid := range db.fileIds {
+		dataFile := db.olderFiles[uint32(fid)]
+		if dataFile == nil {
+			dataFile = db.activeFile
+		}
+
+		var offset int64 = 0
+		for {
+			logRecord, size, err := dataFile.ReadLogRecord(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if _, recordSeqNo := parseLogRecordKey(logRecord.Key); recordSeqNo > seqNo {
+				seqNo = recordSeqNo
+			}
+			offset += size
+		}
+	}
+
+	db.seqNo = seqNo
+	return nil
+}
+
+// 将当前事务序列号写入dirPath中的序列号文件
+func (db *DB) saveSeqNo(dirPath string) error {
+	seqNoFile, err := data.OpenSeqNoFile(db.opt.FS, dirPath)
 	if err != nil {
 		return err
 	}
+	defer seqNoFile.Close()
 
 	logRecord := &data.LogRecord{
 		Key:   []byte(seqNoKey),
@@ -321,10 +552,11 @@ func (db *DB) Close() error {
 		return err
 	}
 
-	if err := seqNoFile.Sync(); err != nil {
-		return err
-	}
+	return seqNoFile.Sync()
+}
 
+// 关闭所有数据文件
+func (db *DB) closeDataFiles() error {
 	if err := db.activeFile.Close(); err != nil {
 		return err
 	}
@@ -351,41 +583,207 @@ func (db *DB) Sync() error {
 	return db.activeFile.Sync()
 }
 
+// 只读模式下加载写进程新追加的数据，写模式下无需刷新
+func (db *DB) Refresh() error {
+	if !db.opt.ReadOnly {
+		return nil
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// 继续读取活跃文件中新追加的记录
+	if db.activeFile != nil {
+		offset, err := db.replayDataFile(db.activeFile, db.activeFile.WriteOff, true)
+		if err != nil {
+			return err
+		}
+		db.activeFile.WriteOff = offset
+	}
+
+	// 写进程切换活跃文件之后产生的新数据文件
+	fileIds, err := listDataFileIds(db.opt.FS, db.opt.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, fid := range fileIds {
+		if db.activeFile != nil && uint32(fid) <= db.activeFile.FileID {
+			continue
+		}
+
+		dataFile, err := data.OpenDataFile(db.opt.FS, db.opt.DirPath, uint32(fid), fio.StandardFIO)
+		if err != nil {
+			return err
+		}
+		if db.activeFile != nil {
+			// 写进程已经切换了活跃文件，读取上次刷新之后追加的剩余记录
+			offset, err := db.replayDataFile(db.activeFile, db.activeFile.WriteOff, false)
+			if err != nil {
+				return err
+			}
+			db.activeFile.WriteOff = offset
+			if db.opt.MMapOlderFiles {
+				if err := db.activeFile.SetIoManager(db.opt.FS, db.opt.DirPath, fio.MemoryMap); err != nil {
+					return err
+				}
+			}
+			db.olderFiles[db.activeFile.FileID] = db.activeFile
+		}
+		db.activeFile = dataFile
+		db.fileIds = append(db.fileIds, fid)
+
+		offset, err := db.replayDataFile(dataFile, 0, true)
+		if err != nil {
+			return err
+		}
+		dataFile.WriteOff = offset
+	}
+
+	return nil
+}
+
 func (db *DB) Delete(key []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.delete(key)
+}
+
+// 删除数据并更新内存索引
+// 访问此方法前必须持有互斥锁
+func (db *DB) delete(key []byte) error {
 	// key 在索引中不存在
 	if pos := db.index.Get(key); pos == nil {
 		return nil
 	}
 
+	logRecord := &data.LogRecord{
+		Key:   logRecordKeyWithSeqNo(key, db.nextSeqNo()),
+		Type:  data.LogRecordDeleted,
+		Flags: data.LogRecordVersioned,
+	}
+
+	pos, err := db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	if pos != nil {
+		db.reclaimSize += int64(pos.Size)
+	}
+
 	oldPos, ok := db.index.Delete(key)
 	if !ok {
 		return ErrIndexUpdateFailed
 	}
 	if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
+		db.addHistory(nil, key, oldPos, pos)
+	}
+
+	return nil
+}
+
+// 删除区间 [start, end) 内的所有key，end为空表示删除start之后的所有key
+// 只写入一条区间墓碑记录，并在持有锁的情况下原子地更新内存索引
+func (db *DB) DeleteRange(start, end []byte) error {
+	return db.deleteRange(nil, start, end)
+}
+
+// ns为nil表示默认命名空间
+func (db *DB) deleteRange(ns *Namespace, start, end []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if end != nil && bytes.Compare(start, end) > 0 {
+		return ErrInvalidRange
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	idx, recordKey, flags := db.index, start, data.LogRecordFlag(0)
+	if ns != nil {
+		idx, recordKey, flags = ns.index, encodeNamespaceKey(ns.name, start), data.LogRecordNamespaced
+	}
+
+	// 区间内没有key，不需要写入墓碑
+	keys := rangeKeys(idx, start, end)
+	if len(keys) == 0 {
+		return nil
 	}
 
 	logRecord := &data.LogRecord{
-		Key:  logRecordKeyWithSeqNo(key, nonTransactionSeqNo),
-		Type: data.LogRecordDeleted,
+		Key:   logRecordKeyWithSeqNo(recordKey, db.nextSeqNo()),
+		Value: end,
+		Type:  data.LogRecordRangeDeleted,
+		Flags: flags | data.LogRecordVersioned,
 	}
 
-	pos, err := db.appendLogRecordWithLock(logRecord)
+	pos, err := db.appendLogRecord(logRecord)
 	if err != nil {
 		return err
 	}
-	if pos != nil {
-		db.reclaimSize += int64(pos.Size)
+	db.addReclaimSize(ns, pos.Size)
+
+	for _, key := range keys {
+		if oldPos, _ := idx.Delete(key); oldPos != nil {
+			db.addReclaimSize(ns, oldPos.Size)
+			db.addHistory(ns, key, oldPos, pos)
+		}
 	}
 
 	return nil
 }
 
+// 删除所有以prefix为前缀的key
+func (db *DB) DeletePrefix(prefix []byte) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(prefix) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	return db.DeleteRange(prefix, prefixSuccessor(prefix))
+}
+
+// 取出索引中位于区间 [start, end) 内的所有key
+// 先收集再删除，避免B+树在迭代事务未结束时执行写事务
+func rangeKeys(idx index.Indexer, start, end []byte) [][]byte {
+	var keys [][]byte
+	it := idx.Iterator(false)
+	defer it.Close()
+	for it.Seek(start); it.Valid(); it.Next() {
+		if end != nil && bytes.Compare(it.Key(), end) >= 0 {
+			break
+		}
+		// B+树迭代器返回的key指向事务内存，事务结束后会被覆盖
+		keys = append(keys, append([]byte(nil), it.Key()...))
+	}
+	return keys
+}
+
 func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
+	logRecord, err := db.getLogRecordByPosition(pos)
+	if err != nil {
+		return nil, err
+	}
+
+	return logRecord.Value, nil
+}
+
+// 根据索引位置读取日志记录
+func (db *DB) getLogRecordByPosition(pos *data.LogRecordPos) (*data.LogRecord, error) {
 	// key不存在
 	if pos == nil {
 		return nil, ErrKeyNotFound
@@ -402,26 +800,28 @@ func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
 		return nil, ErrDataFileNotFound
 	}
 
-	logRecord, _, err := dataFile.ReadLogRecord(pos.Offset)
+	logRecord, size, err := dataFile.ReadLogRecord(pos.Offset)
 	if err != nil {
 		return nil, err
 	}
+	// 读取到的记录与索引中记录的大小不一致，索引指向了错误的位置
+	if pos.Size != 0 && size != int64(pos.Size) {
+		return nil, data.ErrPositionMismatch
+	}
 
 	if logRecord.Type == data.LogRecordDeleted {
 		return nil, ErrKeyNotFound
 	}
 
-	return logRecord.Value, nil
-}
-
-func (db *DB) appendLogRecordWithLock(lr *data.LogRecord) (*data.LogRecordPos, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	return db.appendLogRecord(lr)
+	return logRecord, nil
 }
 
 // 将日志记录追加到当前活跃文件
 func (db *DB) appendLogRecord(lr *data.LogRecord) (*data.LogRecordPos, error) {
+	if db.opt.ReadOnly {
+		return nil, ErrReadOnly
+	}
+
 	// 判断当前活跃数据文件是否存在，不存在则初始化数据文件
 	if db.activeFile == nil {
 		if err := db.setActiveDataFile(); err != nil {
@@ -429,7 +829,13 @@ func (db *DB) appendLogRecord(lr *data.LogRecord) (*data.LogRecordPos, error) {
 		}
 	}
 
+	// 历史版本模式和v2格式下记录写入时间
+	if (db.historyEnabled() || db.opt.RecordFormat == data.RecordFormatV2) && lr.Timestamp == 0 {
+		lr.Timestamp = time.Now().UnixNano()
+	}
+
 	// 将LogRecord编码为字节数组
+	lr.Checksum, lr.Format = db.opt.Checksum, db.opt.RecordFormat
 	encRecord, size := data.EncodeLogRecord(lr)
 
 	// 如果待写入数据大小超过活跃文件可写空间，需要将活跃文件持久化并打开新的数据文件
@@ -471,29 +877,79 @@ func (db *DB) appendLogRecord(lr *data.LogRecord) (*data.LogRecordPos, error) {
 		}
 	}
 
+	_, version := parseLogRecordKey(lr.Key)
 	pos := &data.LogRecordPos{
-		Fid:    db.activeFile.FileID,
-		Offset: writeOff,
-		Size:   uint32(size),
+		Fid:       db.activeFile.FileID,
+		Offset:    writeOff,
+		Size:      uint32(size),
+		Version:   version,
+		Timestamp: lr.Timestamp,
 	}
 
 	return pos, nil
 }
 
+// 分配新的序列号，作为非事务写入的版本号
+// 访问此方法前必须持有互斥锁
+func (db *DB) nextSeqNo() uint64 {
+	return atomic.AddUint64(&db.seqNo, 1)
+}
+
 // 设置当前活跃文件
 // 访问此方法前必须持有互斥锁
 func (db *DB) setActiveDataFile() error {
 	var initialFileID uint32 = 0
 	if db.activeFile != nil {
+		// 封存旧的活跃文件，追加尾部校验记录
+		if db.activeFile.WriteOff > 0 {
+			if err := db.activeFile.Seal(db.opt.Checksum); err != nil {
+				return err
+			}
+			if err := db.activeFile.Sync(); err != nil {
+				return err
+			}
+		}
+		// 截掉旧的活跃文件预分配的空间
+		if err := db.activeFile.IoManager.Truncate(db.activeFile.WriteOff); err != nil {
+			return err
+		}
+		// 持有写锁，没有正在进行的读取，可以安全地切换IO类型或重新映射
+		if typ := db.olderFileIoType(); typ != db.ioType() {
+			if err := db.activeFile.SetIoManager(db.opt.FS, db.opt.DirPath, typ); err != nil {
+				return err
+			}
+		}
 		db.olderFiles[db.activeFile.FileID] = db.activeFile
 		initialFileID = db.activeFile.FileID + 1
 	}
 
+	// 先在元数据中记录新的数据文件，再创建文件
+	fileIds := []uint32{initialFileID}
+	for fid := range db.olderFiles {
+		fileIds = append(fileIds, fid)
+	}
+	if err := writeManifest(db.opt.FS, db.opt.DirPath, db.newManifest(fileIds)); err != nil {
+		return err
+	}
+
 	// 打开新的数据文件
-	dataFile, err := data.OpenDataFile(db.opt.DirPath, initialFileID, fio.StandardFIO)
+	dataFile, err := data.OpenDataFile(db.opt.FS, db.opt.DirPath, initialFileID, db.ioType())
 	if err != nil {
 		return err
 	}
+	dataFile.TrackChecksum(db.opt.Checksum)
+	// 持久化新建的文件项，否则掉电之后已经Sync的数据可能随文件一起丢失
+	if err := db.opt.FS.SyncDir(db.opt.DirPath); err != nil {
+		_ = dataFile.Close()
+		return err
+	}
+
+	// 按数据文件大小预分配空间
+	if p, ok := dataFile.IoManager.(fio.Preallocator); ok {
+		if err := p.Preallocate(db.opt.DataFileSize); err != nil {
+			return err
+		}
+	}
 
 	db.activeFile = dataFile
 	return nil
@@ -512,31 +968,52 @@ func checkOptions(opt Options) error {
 		return errors.New("invlaie data file merge, must between 0 and 1")
 	}
 
+	for _, typ := range opt.NamespaceIndexTypes {
+		if typ == BPlusTree {
+			return errors.New("namespace does not support b+ tree index")
+		}
+	}
+
+	if opt.HistoryVersions < 0 || opt.HistoryRetention < 0 {
+		return errors.New("history versions and retention cannot be negative")
+	}
+
+	// B+树索引不从数据文件中加载，无法恢复历史版本
+	if opt.IndexType == BPlusTree && (opt.HistoryVersions > 0 || opt.HistoryRetention > 0) {
+		return errors.New("history mode does not support b+ tree index")
+	}
+
+	// B+树索引文件直接保存在磁盘上
+	if _, ok := opt.fileSystem().(fio.OSFS); opt.IndexType == BPlusTree && !ok {
+		return errors.New("b+ tree index requires the os file system")
+	}
+
+	if !data.ValidChecksum(opt.Checksum) {
+		return errors.New("invalid checksum type")
+	}
+
+	if opt.RecordFormat > data.RecordFormatV2 {
+		return errors.New("invalid record format")
+	}
+
+	// 只读的内存映射无法写入
+	if opt.IOType == fio.MemoryMap {
+		return errors.New("io type cannot be read-only memory map")
+	}
+
+	// B+树索引文件由写进程独占
+	if opt.IndexType == BPlusTree && opt.ReadOnly {
+		return errors.New("read-only mode does not support b+ tree index")
+	}
+
 	return nil
 }
 
 func (db *DB) loadDataFiles() error {
-	// 根据配置项将目录中的数据文件都读取出来
-	dirEntries, err := os.ReadDir(db.opt.DirPath)
+	fileIds, err := listDataFileIds(db.opt.FS, db.opt.DirPath)
 	if err != nil {
 		return err
 	}
-
-	var fileIds []int
-	// 遍历找到以 ".data"结尾的数据文件
-	for _, entry := range dirEntries {
-		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
-			splitNames := strings.Split(entry.Name(), ".")
-			fileId, err := strconv.Atoi(splitNames[0])
-			if err != nil {
-				return ErrDataDirectoryCorrupted
-			}
-			fileIds = append(fileIds, fileId)
-		}
-	}
-
-	// 对文件ID进行排序（升序）
-	sort.Ints(fileIds)
 	db.fileIds = fileIds
 
 	// 遍历文件ID，打开对应的数据文件
@@ -546,7 +1023,7 @@ func (db *DB) loadDataFiles() error {
 			ioType = fio.MemoryMap
 		}
 
-		dataFile, err := data.OpenDataFile(db.opt.DirPath, uint32(fid), ioType)
+		dataFile, err := data.OpenDataFile(db.opt.FS, db.opt.DirPath, uint32(fid), ioType)
 		if err != nil {
 			return err
 		}
@@ -560,6 +1037,32 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
+// 获取目录中所有数据文件的ID，按升序排列
+func listDataFileIds(fsys fio.FS, dirPath string) ([]int, error) {
+	// 根据配置项将目录中的数据文件都读取出来
+	dirEntries, err := fsys.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileIds []int
+	// 遍历找到以 ".data"结尾的数据文件
+	for _, entry := range dirEntries {
+		if strings.HasSuffix(entry.Name(), data.DataFileNameSuffix) {
+			splitNames := strings.Split(entry.Name(), ".")
+			fileId, err := strconv.Atoi(splitNames[0])
+			if err != nil {
+				return nil, ErrDataDirectoryCorrupted
+			}
+			fileIds = append(fileIds, fileId)
+		}
+	}
+
+	// 对文件ID进行排序（升序）
+	sort.Ints(fileIds)
+	return fileIds, nil
+}
+
 // 遍历文件所有记录，更新到内存索引中
 func (db *DB) loadIndexFromDataFiles() error {
 	// 数据库为空
@@ -571,33 +1074,14 @@ func (db *DB) loadIndexFromDataFiles() error {
 	hasMerge, nonMergeFileId := false, uint32(0)
 
 	mergeFinFileName := filepath.Join(db.opt.DirPath, data.MergeFinishedFileName)
-	if _, err := os.Stat(mergeFinFileName); err == nil {
+	if _, err := db.opt.FS.Stat(mergeFinFileName); err == nil {
 		hasMerge = true
-		nonMergeFileId, err = db.getNonMergeFileID(db.opt.DirPath)
+		nonMergeFileId, err = getNonMergeFileID(db.opt.FS, db.opt.DirPath)
 		if err != nil {
 			return err
 		}
 	}
 
-	updateIndex := func(key []byte, typ data.LogRecordType, logRecordPos *data.LogRecordPos) {
-		var oldPos *data.LogRecordPos
-		// 重要：判断记录是否被删除
-		if typ == data.LogRecordDeleted {
-			oldPos, _ = db.index.Delete(key)
-			db.reclaimSize += int64(logRecordPos.Size)
-		} else {
-			oldPos = db.index.Put(key, logRecordPos)
-		}
-		if oldPos != nil {
-			db.reclaimSize += int64(oldPos.Size)
-		}
-	}
-
-	// 暂存事务数据，包含事务ID、记录和内存索引，直到ReadLogRecord读到事务完成记录
-	txnRecords := make(map[uint64][]*data.TxnRecord)
-	// 便于在加载数据文件时获得最新的序列号
-	var currentSeqNo = nonTransactionSeqNo
-
 	for i, fid := range db.fileIds {
 		var fileId = uint32(fid)
 		var dataFile *data.DataFile
@@ -613,61 +1097,136 @@ func (db *DB) loadIndexFromDataFiles() error {
 			dataFile = db.olderFiles[fileId]
 		}
 
-		var offset int64 = 0
-		for {
-			logRecord, size, err := dataFile.ReadLogRecord(offset)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return err
-			}
+		offset, err := db.replayDataFile(dataFile, 0, i == len(db.fileIds)-1)
+		if err != nil {
+			return err
+		}
 
-			logRecordPos := &data.LogRecordPos{
-				Fid:    dataFile.FileID,
-				Offset: offset,
-				Size:   uint32(size),
-			}
+		if i == len(db.fileIds)-1 {
+			db.activeFile.WriteOff = offset
+		}
+	}
 
-			// 解析日志记录是否是通过事务写入的，取得事务序列号
-			realKey, seqNo := parseLogRecordKey(logRecord.Key)
+	// 写模式下未完成的事务不会再完成，只读模式下需要保留，等待写进程追加事务完成记录
+	if !db.opt.ReadOnly {
+		db.pendingTxns = nil
+	}
 
-			// 更新内存索引
-			if seqNo == nonTransactionSeqNo {
-				// 不是事务数据，直接更新内存索引
-				updateIndex(realKey, logRecord.Type, logRecordPos)
-			} else {
-				// 识别到事务提交标识，更新内存索引
-				if logRecord.Type == data.LogRecordTxnFinished {
-					for _, txnRecord := range txnRecords[seqNo] {
-						updateIndex(txnRecord.Record.Key, txnRecord.Record.Type, txnRecord.Pos)
-					}
-					// 重要：删除已提交事务数据
-					delete(txnRecords, seqNo)
-				} else {
-					logRecord.Key = realKey
-					txnRecords[seqNo] = append(txnRecords[seqNo], &data.TxnRecord{
-						Record: logRecord,
-						Pos:    logRecordPos,
-					})
-				}
+	return nil
+}
+
+// 从offset开始遍历数据文件中的记录并更新内存索引，返回遍历结束的位置
+// 只读模式下活跃文件的末尾可能是写进程正在写入的不完整记录，遇到时停止遍历
+func (db *DB) replayDataFile(dataFile *data.DataFile, offset int64, isActive bool) (int64, error) {
+	for {
+		logRecord, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if err == data.ErrInvalidCRC && db.opt.ReadOnly && isActive {
+				break
 			}
+			return 0, err
+		}
+		// 尾部校验记录不包含数据
+		if logRecord.Type == data.LogRecordFileTrailer {
+			offset += size
+			continue
+		}
+
+		logRecordPos := &data.LogRecordPos{
+			Fid:       dataFile.FileID,
+			Offset:    offset,
+			Size:      uint32(size),
+			Timestamp: logRecord.Timestamp,
+		}
 
-			// 重要：如果读取到事务记录，更新当前事务序列号
-			if seqNo > currentSeqNo {
-				currentSeqNo = seqNo
+		// 解析日志记录是否是通过事务写入的，取得事务序列号
+		realKey, seqNo := parseLogRecordKey(logRecord.Key)
+		logRecordPos.Version = seqNo
+
+		// 更新内存索引
+		if seqNo == nonTransactionSeqNo || logRecord.Flags&data.LogRecordVersioned != 0 {
+			// 不是事务数据，直接更新内存索引
+			db.replayLogRecord(realKey, logRecord, logRecordPos)
+		} else {
+			// 识别到事务提交标识，更新内存索引
+			if logRecord.Type == data.LogRecordTxnFinished {
+				for _, txnRecord := range db.pendingTxns[seqNo] {
+					db.replayLogRecord(txnRecord.Record.Key, txnRecord.Record, txnRecord.Pos)
+				}
+				// 重要：删除已提交事务数据
+				delete(db.pendingTxns, seqNo)
+			} else {
+				logRecord.Key = realKey
+				db.pendingTxns[seqNo] = append(db.pendingTxns[seqNo], &data.TxnRecord{
+					Record: logRecord,
+					Pos:    logRecordPos,
+				})
 			}
+		}
 
-			offset += size
+		// 重要：更新数据库的全局序列号，hint文件中可能已经加载过更大的序列号
+		if seqNo > db.seqNo {
+			db.seqNo = seqNo
 		}
 
-		if i == len(db.fileIds)-1 {
-			db.activeFile.WriteOff = offset
+		offset += size
+	}
+
+	return offset, nil
+}
+
+// 遍历数据文件，返回最后一条有效记录的结束位置
+func dataFileEnd(dataFile *data.DataFile) (int64, error) {
+	var offset int64 = 0
+	for {
+		_, size, err := dataFile.ReadLogRecord(offset)
+		if err != nil {
+			if err == io.EOF {
+				return offset, nil
+			}
+			return 0, err
 		}
+		offset += size
 	}
+}
 
-	// 重要：更新数据库的全局事务序列号
-	db.seqNo = currentSeqNo
+// 将数据文件中的一条记录更新到内存索引中
+func (db *DB) replayLogRecord(key []byte, lr *data.LogRecord, logRecordPos *data.LogRecordPos) {
+	// 找到key所属命名空间的索引
+	idx, ns, key := db.resolveKey(key, lr.Flags, true)
+
+	var oldPos *data.LogRecordPos
+	// 区间删除，删除索引中位于区间内的所有key
+	if lr.Type == data.LogRecordRangeDeleted {
+		db.addReclaimSize(ns, logRecordPos.Size)
+		var end []byte
+		if len(lr.Value) > 0 {
+			end = lr.Value
+		}
+		for _, rangeKey := range rangeKeys(idx, key, end) {
+			if rangePos, _ := idx.Delete(rangeKey); rangePos != nil {
+				db.addReclaimSize(ns, rangePos.Size)
+				db.addHistory(ns, rangeKey, rangePos, logRecordPos)
+			}
+		}
+		return
+	}
 
-	return nil
+	// 重要：判断记录是否被删除
+	if lr.Type == data.LogRecordDeleted {
+		oldPos, _ = idx.Delete(key)
+		db.addReclaimSize(ns, logRecordPos.Size)
+		if oldPos != nil {
+			db.addHistory(ns, key, oldPos, logRecordPos)
+		}
+	} else {
+		oldPos = idx.Put(key, logRecordPos)
+		db.addHistory(ns, key, oldPos)
+	}
+	if oldPos != nil {
+		db.addReclaimSize(ns, oldPos.Size)
+	}
 }
@@ -1,7 +1,10 @@
 package bitcask
 
 import (
+	"bitcask/data"
+	"bitcask/fio"
 	"bitcask/utils"
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -15,7 +18,7 @@ func destroyDB(db *DB) {
 		if db.activeFile != nil {
 			_ = db.Close()
 		}
-		err := os.RemoveAll(db.opt.DirPath)
+		err := db.opt.FS.RemoveAll(db.opt.DirPath)
 		if err != nil {
 			panic(err)
 		}
@@ -382,6 +385,178 @@ func TestDB_Backup(t *testing.T) {
 	t.Log(string(res), err)
 }
 
+func TestDB_DeleteRange(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-delete-range")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Put([]byte("user-1"), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = db.Put([]byte("user-2"), utils.RandomValue(24))
+	assert.Nil(t, err)
+
+	// 1.区间删除
+	err = db.DeleteRange(utils.GetTestKey(10), utils.GetTestKey(20))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(10))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(utils.GetTestKey(19))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(utils.GetTestKey(20))
+	assert.Nil(t, err)
+	assert.Equal(t, 92, len(db.ListKeys()))
+
+	// 2.前缀删除
+	err = db.DeletePrefix([]byte("user-"))
+	assert.Nil(t, err)
+	assert.Equal(t, 90, len(db.ListKeys()))
+
+	// 3.非法区间
+	err = db.DeleteRange(utils.GetTestKey(20), utils.GetTestKey(10))
+	assert.Equal(t, ErrInvalidRange, err)
+
+	// 4.区间删除之后重新写入
+	err = db.Put(utils.GetTestKey(15), utils.RandomValue(24))
+	assert.Nil(t, err)
+
+	// 5.重启之后区间删除仍然有效
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 91, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(14))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(15))
+	assert.Nil(t, err)
+	_, err = db2.Get([]byte("user-1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 6.删除之后所有key
+	err = db2.DeleteRange(utils.GetTestKey(50), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 41, len(db2.ListKeys()))
+	db = db2
+}
+
+func TestDB_DeleteRange_BPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-delete-range-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 300; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+
+	// 1.区间删除，收集的key不能引用已经结束的事务内存
+	err = db.DeleteRange(utils.GetTestKey(10), utils.GetTestKey(20))
+	assert.Nil(t, err)
+	for i := 10; i < 20; i++ {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	assert.Equal(t, 290, len(db.ListKeys()))
+
+	// 2.前缀删除
+	err = db.DeletePrefix([]byte("bitcask-key-0000001"))
+	assert.Nil(t, err)
+	for i := 100; i < 200; i++ {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	assert.Equal(t, 190, len(db.ListKeys()))
+
+	// 3.重启之后索引与数据一致
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 190, len(db2.ListKeys()))
+	_, err = db2.Get(utils.GetTestKey(15))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db2.Get(utils.GetTestKey(250))
+	assert.Nil(t, err)
+	db = db2
+}
+
+func TestDB_GetWithVersion(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-version")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.每次写入都分配递增的版本号
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	_, v1, err := db.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	_, v2, err := db.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.True(t, v2 > v1)
+
+	// 2.删除也会消耗版本号
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	_, _, err = db.GetWithVersion(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	err = db.Put(utils.GetTestKey(3), utils.RandomValue(24))
+	assert.Nil(t, err)
+	_, v3, err := db.GetWithVersion(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, v2+3, v3)
+
+	// 3.重启之后版本号不变，新的写入继续递增
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	_, v, err := db2.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, v2, v)
+
+	// 4.merge之后版本号不变
+	err = db2.Merge()
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+	db3, err := OpenDB(opts)
+	assert.Nil(t, err)
+	_, v, err = db3.GetWithVersion(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, v3, v)
+
+	err = db3.Put(utils.GetTestKey(4), utils.RandomValue(24))
+	assert.Nil(t, err)
+	_, v4, err := db3.GetWithVersion(utils.GetTestKey(4))
+	assert.Nil(t, err)
+	assert.True(t, v4 > v3)
+	db = db3
+}
+
 // func TestDB_Open2(t *testing.T) {
 // 	opts := DefaultOptions
 // 	opts.DirPath = "/tmp/bitcask-go-put3440586241"
@@ -394,3 +569,259 @@ func TestDB_Backup(t *testing.T) {
 // 	assert.Nil(t, err)
 // 	assert.NotNil(t, db)
 // }
+
+func TestDB_MMapRW(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-mmap-rw")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IOType = fio.MemoryMapRW
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Sync()
+	assert.Nil(t, err)
+	assert.True(t, len(db.olderFiles) > 0)
+
+	// 旧的数据文件切换时截掉了预分配的空间
+	info, err := os.Stat(data.GetFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, db.olderFiles[0].WriteOff, info.Size())
+
+	// 模拟异常退出，活跃文件末尾留有预分配的空间
+	err = db.Close()
+	assert.Nil(t, err)
+	activeFile := data.GetFileName(dir, db.activeFile.FileID)
+	info, err = os.Stat(activeFile)
+	assert.Nil(t, err)
+	err = os.Truncate(activeFile, info.Size()+4096)
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1000), utils.RandomValue(128))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1001, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(1000))
+	assert.Nil(t, err)
+}
+
+func TestDB_MMapOlderFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-mmap-older")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.MMapOlderFiles = true
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 1000; i++ {
+		values[i] = utils.RandomValue(128)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+
+	// 切换活跃文件之后旧的数据文件被重新映射
+	assert.True(t, len(db.olderFiles) > 0)
+	for _, dataFile := range db.olderFiles {
+		_, ok := dataFile.IoManager.(*fio.MMap)
+		assert.True(t, ok)
+	}
+	_, ok := db.activeFile.IoManager.(*fio.FileIO)
+	assert.True(t, ok)
+	for i := 0; i < 1000; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+
+	// merge之后重启，替换后的数据文件重新映射
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	for _, dataFile := range db.olderFiles {
+		_, ok := dataFile.IoManager.(*fio.MMap)
+		assert.True(t, ok)
+	}
+	for i := 0; i < 1000; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+}
+
+func TestDB_BufferedFIO(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-buffered")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IOType = fio.BufferedFIO
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 1000; i++ {
+		values[i] = utils.RandomValue(24)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+
+	// 读取尚未写入文件的数据
+	for i := 0; i < 1000; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+
+	// 关闭时写入缓冲区中的数据
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	val, err := db.Get(utils.GetTestKey(999))
+	assert.Nil(t, err)
+	assert.Equal(t, values[999], val)
+}
+
+func TestDB_DirectFIO(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-direct")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IOType = fio.DirectFIO
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 1000; i++ {
+		values[i] = utils.RandomValue(128)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	err = db.Sync()
+	assert.Nil(t, err)
+
+	// 旧的数据文件截掉了补零的部分，使用标准文件IO读取
+	assert.True(t, len(db.olderFiles) > 0)
+	info, err := os.Stat(data.GetFileName(dir, 0))
+	assert.Nil(t, err)
+	assert.Equal(t, db.olderFiles[0].WriteOff, info.Size())
+	_, ok := db.olderFiles[0].IoManager.(*fio.FileIO)
+	assert.True(t, ok)
+	for i := 0; i < 1000; i++ {
+		val, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		assert.Equal(t, values[i], val)
+	}
+
+	// 模拟异常退出，活跃文件末尾留有补零的块
+	err = db.Close()
+	assert.Nil(t, err)
+	activeFile := data.GetFileName(dir, db.activeFile.FileID)
+	info, err = os.Stat(activeFile)
+	assert.Nil(t, err)
+	err = os.Truncate(activeFile, (info.Size()/4096+1)*4096)
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1000), utils.RandomValue(128))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1001, len(db.ListKeys()))
+	val, err := db.Get(utils.GetTestKey(999))
+	assert.Nil(t, err)
+	assert.Equal(t, values[999], val)
+}
+
+func TestDB_RecordFormatV2(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-format"
+	opts.DataFileSize = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.InMemory = true
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	values := make(map[int][]byte)
+	for i := 0; i < 500; i++ {
+		values[i] = utils.RandomValue(64)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(0), db.index.Get(utils.GetTestKey(0)).Timestamp)
+
+	// 切换为v2格式之后，v1格式的记录仍然可以读取
+	err = db.Close()
+	assert.Nil(t, err)
+	opts.FS = db.opt.FS
+	opts.RecordFormat = data.RecordFormatV2
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	for i := 250; i < 750; i++ {
+		values[i] = utils.RandomValue(64)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+		delete(values, i)
+	}
+	assert.NotEqual(t, int64(0), db.index.Get(utils.GetTestKey(500)).Timestamp)
+
+	check := func() {
+		assert.Equal(t, len(values), len(db.ListKeys()))
+		for i, value := range values {
+			val, err := db.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, value, val)
+		}
+		assert.Nil(t, db.Verify(context.Background()))
+	}
+	check()
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	check()
+	// merge之后的记录按当前格式重写，并记录写入时间
+	assert.NotEqual(t, int64(0), db.index.Get(utils.GetTestKey(100)).Timestamp)
+
+	opts.RecordFormat = data.RecordFormatV2 + 1
+	opts.DirPath = "/bitcask-go-format-invalid"
+	_, err = OpenDB(opts)
+	assert.NotNil(t, err)
+}
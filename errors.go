@@ -13,4 +13,20 @@ var (
 	ErrDatabaseIsUsing        = errors.New("the data directory is used by another process")
 	ErrMergeRationUnreached   = errors.New("the merge ratio does not reach the option")
 	ErrNoEnoughSpaceToMerge   = errors.New("no enough disk space to merge")
+	ErrIteratorKeysOnly       = errors.New("the iterator only iterates keys")
+	ErrInvalidRange           = errors.New("the start of range is greater than the end")
+	ErrNamespaceIsEmpty       = errors.New("the namespace name is empty")
+	ErrNamespaceUnsupported   = errors.New("namespace is not supported by b+ tree index")
+	ErrHistoryDisabled        = errors.New("the history mode is not enabled")
+	ErrReadOnly               = errors.New("the database is opened in read-only mode")
+	ErrBackupUnsupported      = errors.New("incremental backup is not supported by b+ tree index")
+	ErrBackupNotFound         = errors.New("the backup manifest is not found")
+	ErrTargetDirNotEmpty      = errors.New("the target directory is not empty")
+	ErrRestorePointMerged     = errors.New("the restore point is earlier than the last merge")
+	ErrExportCorrupted        = errors.New("the export data is corrupted")
+	ErrIndexTypeMismatch      = errors.New("the index type does not match the data directory, migrate it first")
+	ErrIndexTypeUnsupported   = errors.New("the index type migration is not supported")
+	ErrManifestIncompatible   = errors.New("the manifest is written by an incompatible version")
+	ErrManifestMismatch       = errors.New("the data files do not match the manifest")
+	ErrDataCorrupted          = errors.New("the data files are corrupted, see the corruptions in stat")
 )
@@ -0,0 +1,279 @@
+package bitcask
+
+import (
+	"bitcask/index"
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+	"sort"
+)
+
+// 导出格式，与磁盘上的数据文件布局和索引类型无关
+//
+// 二进制格式：
+//
+//	|  magic "BCEX"  |  version  |  record ...  |  end  |
+//	record: |  1  |  crc  |  nsSize  |  keySize  |  valueSize  |  ns  |  key  |  value  |
+//	end:    |  0  |  count  |
+//
+// crc为小端序的crc32，覆盖crc之后的所有字段；各长度字段和count为uvarint；ns为空表示默认命名空间
+//
+// JSON Lines格式：每行一个JSON对象 {"ns": "...", "key": "<base64>", "value": "<base64>"}
+const (
+	exportMagic   = "BCEX"
+	exportVersion = 1
+
+	exportRecordKind = 1
+	exportEndKind    = 0
+
+	// 一条记录中所有字段的最大总长度，与索引中记录大小的上限一致
+	maxExportRecordSize = math.MaxUint32
+
+	// 按块读取记录内容，损坏的长度字段不会在校验crc之前一次分配过大的内存
+	exportReadChunkSize = 64 * 1024
+)
+
+type exportJSONRecord struct {
+	Namespace string `json:"ns,omitempty"`
+	Key       []byte `json:"key"`
+	Value     []byte `json:"value"`
+}
+
+// 以二进制格式导出所有命名空间中的数据
+func (db *DB) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(exportMagic); err != nil {
+		return err
+	}
+	if err := bw.WriteByte(exportVersion); err != nil {
+		return err
+	}
+
+	var count uint64
+	err := db.exportEach(func(ns string, key, value []byte) error {
+		header := make([]byte, 1+crc32.Size+binary.MaxVarintLen32*3)
+		header[0] = exportRecordKind
+		n := 1 + crc32.Size
+		n += binary.PutUvarint(header[n:], uint64(len(ns)))
+		n += binary.PutUvarint(header[n:], uint64(len(key)))
+		n += binary.PutUvarint(header[n:], uint64(len(value)))
+
+		crc := crc32.ChecksumIEEE(header[1+crc32.Size : n])
+		crc = crc32.Update(crc, crc32.IEEETable, []byte(ns))
+		crc = crc32.Update(crc, crc32.IEEETable, key)
+		crc = crc32.Update(crc, crc32.IEEETable, value)
+		binary.LittleEndian.PutUint32(header[1:], crc)
+
+		for _, b := range [][]byte{header[:n], []byte(ns), key, value} {
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	end := make([]byte, 1+binary.MaxVarintLen64)
+	end[0] = exportEndKind
+	n := 1 + binary.PutUvarint(end[1:], count)
+	if _, err := bw.Write(end[:n]); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// 导入二进制格式的数据，遇到错误时已经导入的数据不会回滚
+func (db *DB) Import(r io.Reader) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	br := bufio.NewReader(r)
+	header := make([]byte, len(exportMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return ErrExportCorrupted
+	}
+	if string(header[:len(exportMagic)]) != exportMagic || header[len(exportMagic)] != exportVersion {
+		return ErrExportCorrupted
+	}
+
+	importer := db.newImporter()
+	var count uint64
+	for {
+		kind, err := br.ReadByte()
+		if err != nil {
+			return ErrExportCorrupted
+		}
+
+		if kind == exportEndKind {
+			total, err := binary.ReadUvarint(br)
+			if err != nil || total != count {
+				return ErrExportCorrupted
+			}
+			return nil
+		}
+		if kind != exportRecordKind {
+			return ErrExportCorrupted
+		}
+
+		ns, key, value, err := readExportRecord(br)
+		if err != nil {
+			return err
+		}
+		if err := importer(ns, key, value); err != nil {
+			return err
+		}
+		count++
+	}
+}
+
+// 以JSON Lines格式导出所有命名空间中的数据，便于查看和比较
+func (db *DB) ExportJSONLines(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := db.exportEach(func(ns string, key, value []byte) error {
+		return enc.Encode(&exportJSONRecord{Namespace: ns, Key: key, Value: value})
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// 导入JSON Lines格式的数据，遇到错误时已经导入的数据不会回滚
+func (db *DB) ImportJSONLines(r io.Reader) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	dec := json.NewDecoder(r)
+	importer := db.newImporter()
+	for {
+		var record exportJSONRecord
+		if err := dec.Decode(&record); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if len(record.Key) == 0 {
+			return ErrKeyIsEmpty
+		}
+		if err := importer(record.Namespace, record.Key, record.Value); err != nil {
+			return err
+		}
+	}
+}
+
+// 依次遍历默认命名空间和所有命名空间中的数据
+// 每个索引在遍历开始时生成迭代器，读取value时才加锁，导出期间不阻塞写操作
+func (db *DB) exportEach(fn func(ns string, key, value []byte) error) error {
+	db.mu.RLock()
+	names := make([]string, 0, len(db.namespaces))
+	for name := range db.namespaces {
+		names = append(names, name)
+	}
+	db.mu.RUnlock()
+	sort.Strings(names)
+
+	exportIndex := func(ns string, idx index.Indexer) error {
+		it := db.newIterator(idx, DefaultIteratorOptions)
+		defer it.Close()
+		for ; it.Valid(); it.Next() {
+			value, err := it.Value()
+			if err == ErrKeyNotFound {
+				continue // 遍历期间被删除
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(ns, it.Key(), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := exportIndex("", db.index); err != nil {
+		return err
+	}
+	for _, name := range names {
+		db.mu.RLock()
+		ns := db.namespaces[name]
+		db.mu.RUnlock()
+		if err := exportIndex(name, ns.index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 返回写入导入数据的函数，ns为空表示默认命名空间
+func (db *DB) newImporter() func(ns string, key, value []byte) error {
+	namespaces := make(map[string]*Namespace)
+	return func(name string, key, value []byte) error {
+		if name == "" {
+			return db.Put(key, value)
+		}
+
+		ns, ok := namespaces[name]
+		if !ok {
+			var err error
+			if ns, err = db.Namespace(name); err != nil {
+				return err
+			}
+			namespaces[name] = ns
+		}
+		return ns.Put(key, value)
+	}
+}
+
+// 读取一条记录并校验crc
+func readExportRecord(br *bufio.Reader) (string, []byte, []byte, error) {
+	crcBuf := make([]byte, crc32.Size)
+	if _, err := io.ReadFull(br, crcBuf); err != nil {
+		return "", nil, nil, ErrExportCorrupted
+	}
+
+	var sizes [3]uint64
+	var total uint64
+	header := make([]byte, 0, binary.MaxVarintLen32*3)
+	for i := range sizes {
+		size, err := binary.ReadUvarint(br)
+		if err != nil || size > maxExportRecordSize-total {
+			return "", nil, nil, ErrExportCorrupted
+		}
+		sizes[i] = size
+		total += size
+		header = binary.AppendUvarint(header, size)
+	}
+
+	// 缓冲区只随实际读到的数据增长
+	crc := crc32.ChecksumIEEE(header)
+	body := make([]byte, 0, min(total, exportReadChunkSize))
+	for uint64(len(body)) < total {
+		start := len(body)
+		n := int(min(total-uint64(start), exportReadChunkSize))
+		body = slices.Grow(body, n)[:start+n]
+		if _, err := io.ReadFull(br, body[start:]); err != nil {
+			return "", nil, nil, ErrExportCorrupted
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, body[start:])
+	}
+
+	if crc != binary.LittleEndian.Uint32(crcBuf) || sizes[1] == 0 {
+		return "", nil, nil, ErrExportCorrupted
+	}
+
+	ns := string(body[:sizes[0]])
+	key := body[sizes[0] : sizes[0]+sizes[1]]
+	value := body[sizes[0]+sizes[1]:]
+	return ns, key, value, nil
+}
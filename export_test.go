@@ -0,0 +1,138 @@
+package bitcask
+
+import (
+	"bitcask/utils"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export-1")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	err = users.Put([]byte("key"), []byte("users"))
+	assert.Nil(t, err)
+
+	// 导入到使用不同索引类型的数据库
+	importOpts := DefaultOptions
+	importOpts.IndexType = ART
+	for _, format := range []string{"binary", "jsonl"} {
+		var buf bytes.Buffer
+		if format == "binary" {
+			err = db.Export(&buf)
+		} else {
+			err = db.ExportJSONLines(&buf)
+		}
+		assert.Nil(t, err)
+
+		importDir, _ := os.MkdirTemp("", "bitcask-go-export-"+format)
+		importOpts.DirPath = importDir
+		db2, err := OpenDB(importOpts)
+		assert.Nil(t, err)
+		if format == "binary" {
+			err = db2.Import(&buf)
+		} else {
+			err = db2.ImportJSONLines(&buf)
+		}
+		assert.Nil(t, err)
+
+		assert.Equal(t, db.ListKeys(), db2.ListKeys())
+		for _, key := range db.ListKeys() {
+			val1, err := db.Get(key)
+			assert.Nil(t, err)
+			val2, err := db2.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, val1, val2)
+		}
+		users2, err := db2.Namespace("users")
+		assert.Nil(t, err)
+		val, err := users2.Get([]byte("key"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("users"), val)
+		destroyDB(db2)
+	}
+}
+
+func TestDB_Import_Corrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export-2")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 10; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	var buf bytes.Buffer
+	err = db.Export(&buf)
+	assert.Nil(t, err)
+	exported := buf.Bytes()
+
+	// 修改数据导致crc校验失败
+	corrupted := append([]byte{}, exported...)
+	corrupted[len(corrupted)-10] ^= 0xff
+	err = db.Import(bytes.NewReader(corrupted))
+	assert.Equal(t, ErrExportCorrupted, err)
+
+	// 缺少结束标记
+	err = db.Import(bytes.NewReader(exported[:len(exported)-2]))
+	assert.Equal(t, ErrExportCorrupted, err)
+
+	// 不是导出文件
+	err = db.Import(bytes.NewReader([]byte("not an export")))
+	assert.Equal(t, ErrExportCorrupted, err)
+}
+
+func TestDB_Import_HugeSize(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export-3")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	record := func(sizes ...uint64) []byte {
+		buf := append([]byte(exportMagic), exportVersion, exportRecordKind, 0, 0, 0, 0)
+		for _, size := range sizes {
+			buf = binary.AppendUvarint(buf, size)
+		}
+		return append(buf, []byte("short body")...)
+	}
+
+	// 超过记录大小的上限
+	err = db.Import(bytes.NewReader(record(0, math.MaxUint32, 1)))
+	assert.Equal(t, ErrExportCorrupted, err)
+	err = db.Import(bytes.NewReader(record(0, 1<<40, 0)))
+	assert.Equal(t, ErrExportCorrupted, err)
+
+	// 长度字段声明了接近上限的大小，但实际数据很短，不会按声明的大小分配内存
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err = db.Import(bytes.NewReader(record(0, 1<<31, 1<<31-1)))
+	runtime.ReadMemStats(&after)
+	assert.Equal(t, ErrExportCorrupted, err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16*1024*1024))
+}
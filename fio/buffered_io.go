@@ -0,0 +1,146 @@
+package fio
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// 写缓冲区大小，写满之后才调用一次write
+const bufferedWriteSize = 64 * 1024
+
+// 带写缓冲的文件IO，追加的数据先写入用户态缓冲区，写满、Sync或Close时写入文件
+// 缓冲区中的数据在进程崩溃时会丢失，只读进程也无法读取
+type BufferedFileIO struct {
+	mu      *sync.RWMutex
+	fd      *os.File
+	buf     []byte // 尚未写入文件的数据
+	flushed int64  // 已经写入文件的数据大小
+}
+
+func NewBufferedFileIOManager(fileName string) (*BufferedFileIO, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|os.O_APPEND, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	return &BufferedFileIO{
+		mu:      new(sync.RWMutex),
+		fd:      fd,
+		buf:     make([]byte, 0, bufferedWriteSize),
+		flushed: stat.Size(),
+	}, nil
+}
+
+// 读取文件和缓冲区中的数据，offset之后的数据可能一部分在文件中，一部分在缓冲区中
+func (bio *BufferedFileIO) Read(b []byte, offset int64) (int, error) {
+	bio.mu.RLock()
+	defer bio.mu.RUnlock()
+
+	var n int
+	if offset < bio.flushed {
+		end := min(int64(len(b)), bio.flushed-offset)
+		read, err := bio.fd.ReadAt(b[:end], offset)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if n < len(b) {
+		bufOffset := offset + int64(n) - bio.flushed
+		if bufOffset < int64(len(bio.buf)) {
+			n += copy(b[n:], bio.buf[bufOffset:])
+		}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 追加写入缓冲区，缓冲区放不下时先写入文件
+func (bio *BufferedFileIO) Write(b []byte) (int, error) {
+	bio.mu.Lock()
+	defer bio.mu.Unlock()
+
+	if len(bio.buf)+len(b) > cap(bio.buf) {
+		if err := bio.flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	// 不小于缓冲区大小的数据直接写入文件
+	if len(b) >= cap(bio.buf) {
+		n, err := bio.fd.Write(b)
+		bio.flushed += int64(n)
+		return n, err
+	}
+
+	bio.buf = append(bio.buf, b...)
+	return len(b), nil
+}
+
+// 写入缓冲区中的数据并持久化
+func (bio *BufferedFileIO) Sync() error {
+	bio.mu.Lock()
+	defer bio.mu.Unlock()
+
+	if err := bio.flush(); err != nil {
+		return err
+	}
+	return bio.fd.Sync()
+}
+
+// 写入缓冲区中的数据并关闭文件
+func (bio *BufferedFileIO) Close() error {
+	bio.mu.Lock()
+	defer bio.mu.Unlock()
+
+	if err := bio.flush(); err != nil {
+		_ = bio.fd.Close()
+		return err
+	}
+	return bio.fd.Close()
+}
+
+func (bio *BufferedFileIO) Size() (int64, error) {
+	bio.mu.RLock()
+	defer bio.mu.RUnlock()
+	return bio.flushed + int64(len(bio.buf)), nil
+}
+
+// 截断文件，之后的写入从文件末尾继续追加
+func (bio *BufferedFileIO) Truncate(size int64) error {
+	bio.mu.Lock()
+	defer bio.mu.Unlock()
+
+	if err := bio.flush(); err != nil {
+		return err
+	}
+	if err := bio.fd.Truncate(size); err != nil {
+		return err
+	}
+	bio.flushed = size
+	return nil
+}
+
+// 将缓冲区中的数据写入文件，调用前必须持有互斥锁
+func (bio *BufferedFileIO) flush() error {
+	if len(bio.buf) == 0 {
+		return nil
+	}
+
+	n, err := bio.fd.Write(bio.buf)
+	bio.flushed += int64(n)
+	// 部分写入时保留未写入的数据
+	bio.buf = bio.buf[:copy(bio.buf, bio.buf[n:])]
+	return err
+}
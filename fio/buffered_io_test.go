@@ -0,0 +1,88 @@
+package fio
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferedFileIO_WriteRead(t *testing.T) {
+	path := filepath.Join("/tmp", "buffered.data")
+	bio, err := NewBufferedFileIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+	assert.NotNil(t, bio)
+
+	_, err = bio.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = bio.Write([]byte("key-b"))
+	assert.Nil(t, err)
+
+	// 数据还在缓冲区中
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stat.Size())
+	size, err := bio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+
+	b := make([]byte, 5)
+	n, err := bio.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, []byte("key-b"), b)
+
+	// 一部分在文件中，一部分在缓冲区中
+	err = bio.Sync()
+	assert.Nil(t, err)
+	_, err = bio.Write([]byte("key-c"))
+	assert.Nil(t, err)
+	b = make([]byte, 10)
+	n, err = bio.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-bkey-c"), b)
+
+	n, err = bio.Read(b, 10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, []byte("key-c"), b[:n])
+
+	// 缓冲区写满之后写入文件
+	big := make([]byte, bufferedWriteSize)
+	_, err = bio.Write(big)
+	assert.Nil(t, err)
+	stat, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15+bufferedWriteSize), stat.Size())
+
+	_, err = bio.Write([]byte("key-d"))
+	assert.Nil(t, err)
+	err = bio.Close()
+	assert.Nil(t, err)
+	stat, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(20+bufferedWriteSize), stat.Size())
+}
+
+func TestBufferedFileIO_Truncate(t *testing.T) {
+	path := filepath.Join("/tmp", "buffered.data")
+	bio, err := NewBufferedFileIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+
+	_, err = bio.Write([]byte("bitcask kv"))
+	assert.Nil(t, err)
+	err = bio.Truncate(7)
+	assert.Nil(t, err)
+	_, err = bio.Write([]byte("-go"))
+	assert.Nil(t, err)
+
+	b := make([]byte, 10)
+	_, err = bio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "bitcask-go", string(b))
+	err = bio.Close()
+	assert.Nil(t, err)
+}
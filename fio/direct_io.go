@@ -0,0 +1,211 @@
+//go:build linux
+
+package fio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	directAlignSize  = 4096       // O_DIRECT要求缓冲区地址、写入位置和长度按块对齐
+	directBufferSize = 256 * 1024 // 写缓冲区大小，写满之后整块写入文件
+)
+
+// 绕过页缓存的直接IO
+// 追加的数据先写入对齐的缓冲区，写满时整块写入；Sync时将最后不完整的块补零写入，之后的写入会覆盖补零的部分
+// 文件在磁盘上的大小按块对齐，逻辑大小单独记录，Close时截断为逻辑大小；异常退出时末尾的零由启动时的恢复截掉
+type DirectIO struct {
+	mu       *sync.RWMutex
+	fd       *os.File // 以O_DIRECT打开，只用于写
+	reader   *os.File // 普通方式打开，只用于读
+	buf      []byte   // 对齐的写缓冲区，从文件的blockOff位置开始
+	tail     int      // 缓冲区中有效数据的长度
+	blockOff int64    // 缓冲区对应的文件位置，按块对齐
+}
+
+func NewDirectIOManager(fileName string) (*DirectIO, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR|unix.O_DIRECT, DataFilePerm)
+	// 部分文件系统不支持O_DIRECT，退化为普通写
+	if errors.Is(err, unix.EINVAL) {
+		fd, err = os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := os.Open(fileName)
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	stat, err := reader.Stat()
+	if err != nil {
+		_ = fd.Close()
+		_ = reader.Close()
+		return nil, err
+	}
+
+	dio := &DirectIO{mu: new(sync.RWMutex), fd: fd, reader: reader, buf: alignedBuffer(directBufferSize)}
+	if err := dio.loadTail(stat.Size()); err != nil {
+		_ = dio.fd.Close()
+		_ = dio.reader.Close()
+		return nil, err
+	}
+	return dio, nil
+}
+
+func (dio *DirectIO) Read(b []byte, offset int64) (int, error) {
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+
+	var n int
+	if offset < dio.blockOff {
+		end := min(int64(len(b)), dio.blockOff-offset)
+		read, err := dio.reader.ReadAt(b[:end], offset)
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if n < len(b) {
+		bufOffset := offset + int64(n) - dio.blockOff
+		if bufOffset < int64(dio.tail) {
+			n += copy(b[n:], dio.buf[bufOffset:dio.tail])
+		}
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (dio *DirectIO) Write(b []byte) (int, error) {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	written := 0
+	for written < len(b) {
+		n := copy(dio.buf[dio.tail:], b[written:])
+		dio.tail += n
+		written += n
+
+		// 缓冲区写满，整块写入文件
+		if dio.tail == len(dio.buf) {
+			if _, err := dio.fd.WriteAt(dio.buf, dio.blockOff); err != nil {
+				dio.tail -= n
+				return written - n, err
+			}
+			dio.blockOff += int64(len(dio.buf))
+			dio.tail = 0
+		}
+	}
+	return written, nil
+}
+
+// 将缓冲区补齐到块大小写入文件并持久化
+func (dio *DirectIO) Sync() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	if err := dio.flush(); err != nil {
+		return err
+	}
+	return unix.Fdatasync(int(dio.fd.Fd()))
+}
+
+func (dio *DirectIO) Close() error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	err := dio.flush()
+	if err == nil {
+		// 截掉补零的部分和预分配的空间
+		err = dio.fd.Truncate(dio.blockOff + int64(dio.tail))
+	}
+	if closeErr := dio.fd.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dio.reader.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 逻辑大小，不包含补零和预分配的部分
+func (dio *DirectIO) Size() (int64, error) {
+	dio.mu.RLock()
+	defer dio.mu.RUnlock()
+	return dio.blockOff + int64(dio.tail), nil
+}
+
+func (dio *DirectIO) Truncate(size int64) error {
+	dio.mu.Lock()
+	defer dio.mu.Unlock()
+
+	if err := dio.flush(); err != nil {
+		return err
+	}
+	if err := dio.fd.Truncate(size); err != nil {
+		return err
+	}
+	return dio.loadTail(size)
+}
+
+// 使用fallocate为文件预分配空间，不改变文件大小，减少文件系统碎片
+func (dio *DirectIO) Preallocate(size int64) error {
+	err := unix.Fallocate(int(dio.fd.Fd()), unix.FALLOC_FL_KEEP_SIZE, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) {
+		return nil
+	}
+	return err
+}
+
+// 将缓冲区中不完整的块补零写入文件，调用前必须持有互斥锁
+// 写入之后完整的块从缓冲区中移除
+func (dio *DirectIO) flush() error {
+	if dio.tail == 0 {
+		return nil
+	}
+
+	length := (dio.tail + directAlignSize - 1) / directAlignSize * directAlignSize
+	clear(dio.buf[dio.tail:length])
+	if _, err := dio.fd.WriteAt(dio.buf[:length], dio.blockOff); err != nil {
+		return err
+	}
+
+	full := dio.tail / directAlignSize * directAlignSize
+	copy(dio.buf, dio.buf[full:dio.tail])
+	dio.blockOff += int64(full)
+	dio.tail -= full
+	return nil
+}
+
+// 将文件最后不完整的块读入缓冲区，之后从size处继续追加
+func (dio *DirectIO) loadTail(size int64) error {
+	dio.blockOff = size / directAlignSize * directAlignSize
+	dio.tail = int(size - dio.blockOff)
+	if dio.tail == 0 {
+		return nil
+	}
+	_, err := dio.reader.ReadAt(dio.buf[:dio.tail], dio.blockOff)
+	return err
+}
+
+// 分配地址按块对齐的缓冲区
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directAlignSize)
+	offset := int(uintptr(unsafe.Pointer(&buf[0])) & (directAlignSize - 1))
+	if offset != 0 {
+		offset = directAlignSize - offset
+	}
+	return buf[offset : offset+size]
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package fio
+
+import "errors"
+
+// 直接IO依赖O_DIRECT和fallocate，仅支持Linux
+func NewDirectIOManager(fileName string) (IOManager, error) {
+	return nil, errors.New("direct io is only supported on linux")
+}
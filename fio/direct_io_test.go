@@ -0,0 +1,100 @@
+//go:build linux
+
+package fio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	writableIOTypes["DirectIO"] = DirectFIO
+}
+
+func TestDirectIO_WriteRead(t *testing.T) {
+	path := filepath.Join("/tmp", "direct.data")
+	dio, err := NewDirectIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+	assert.NotNil(t, dio)
+
+	// 跨越多个写缓冲区
+	data := bytes.Repeat([]byte("bitcask-"), directBufferSize/8*3)
+	data = append(data, "tail"...)
+	n, err := dio.Write(data)
+	assert.Nil(t, err)
+	assert.Equal(t, len(data), n)
+	size, err := dio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	b := make([]byte, 12)
+	_, err = dio.Read(b, int64(len(data)-12))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask-tail"), b)
+
+	// Sync之后磁盘上的大小按块对齐
+	err = dio.Sync()
+	assert.Nil(t, err)
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stat.Size()%directAlignSize)
+	assert.True(t, stat.Size() > int64(len(data)))
+
+	// 继续追加会覆盖补零的部分
+	_, err = dio.Write([]byte("-more"))
+	assert.Nil(t, err)
+	err = dio.Close()
+	assert.Nil(t, err)
+	stat, err = os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(data)+5), stat.Size())
+
+	// 重新打开之后从逻辑末尾继续追加
+	dio, err = NewDirectIOManager(path)
+	assert.Nil(t, err)
+	_, err = dio.Write([]byte("!"))
+	assert.Nil(t, err)
+	b = make([]byte, 10)
+	_, err = dio.Read(b, int64(len(data)-4))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("tail-more!"), b)
+	err = dio.Close()
+	assert.Nil(t, err)
+}
+
+func TestDirectIO_TruncatePreallocate(t *testing.T) {
+	path := filepath.Join("/tmp", "direct.data")
+	dio, err := NewDirectIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+
+	// 预分配不改变文件大小
+	err = dio.Preallocate(1024 * 1024)
+	assert.Nil(t, err)
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), stat.Size())
+	assert.True(t, stat.Sys().(*syscall.Stat_t).Blocks*512 >= 1024*1024)
+
+	_, err = dio.Write([]byte("bitcask kv"))
+	assert.Nil(t, err)
+	err = dio.Sync()
+	assert.Nil(t, err)
+	err = dio.Truncate(7)
+	assert.Nil(t, err)
+	_, err = dio.Write([]byte("-go"))
+	assert.Nil(t, err)
+
+	b := make([]byte, 10)
+	_, err = dio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "bitcask-go", string(b))
+	err = dio.Close()
+	assert.Nil(t, err)
+}
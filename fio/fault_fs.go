@@ -0,0 +1,265 @@
+package fio
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+var ErrInjectedFault = errors.New("injected io fault")
+
+type FaultKind uint8
+
+const (
+	FaultError      FaultKind = iota // 操作不执行，直接返回错误
+	FaultShortWrite                  // 写入只完成一半之后返回错误，其他操作直接返回错误
+)
+
+// 故障注入文件系统，用于崩溃测试
+// 打开文件和每次修改文件系统的操作都是一个IO步骤，在指定的步骤注入故障之后，之后所有修改操作都返回错误，模拟进程已经停止
+// 文件内容记录已经持久化的部分，目录中的文件项在SyncDir之后才持久化，Crash时可以丢弃未持久化的数据和文件的创建、重命名、删除
+// 目录本身的创建和删除立即持久化，掉电之后仍有文件项的目录会被重新创建
+type FaultFS struct {
+	*MemFS
+	mu      *sync.Mutex
+	synced  map[*memFile][]byte // 每个文件最近一次Sync时的内容
+	durable map[string]*memFile // 最近一次SyncDir时目录中的文件项
+	steps   int                 // 已经执行的IO步骤数
+	failAt  int                 // 在第failAt个步骤注入故障，0表示不注入
+	kind    FaultKind
+	failed  bool // 已经注入故障
+}
+
+func NewFaultFS() *FaultFS {
+	return &FaultFS{
+		MemFS:   NewMemFS(),
+		mu:      new(sync.Mutex),
+		synced:  make(map[*memFile][]byte),
+		durable: make(map[string]*memFile),
+	}
+}
+
+// 在之后的第n个IO步骤注入故障
+func (f *FaultFS) InjectAfter(n int, kind FaultKind) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failAt, f.kind, f.failed = f.steps+n, kind, false
+}
+
+// 已经执行的IO步骤数
+func (f *FaultFS) Steps() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.steps
+}
+
+// 是否已经注入故障
+func (f *FaultFS) Failed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failed
+}
+
+// 模拟崩溃，清除注入的故障并释放所有文件锁
+// dropUnsynced为true时模拟掉电，目录回到最近一次SyncDir时的文件项，所有文件回到最近一次Sync时的内容；否则模拟进程退出，已经写入的数据保留
+func (f *FaultFS) Crash(dropUnsynced bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.MemFS.mu.Lock()
+	defer f.MemFS.mu.Unlock()
+
+	if dropUnsynced {
+		f.MemFS.files = make(map[string]*memFile, len(f.durable))
+		for path, file := range f.durable {
+			f.MemFS.files[path] = file
+			for dir := filepath.Dir(path); !f.MemFS.dirExistsLocked(dir); dir = filepath.Dir(dir) {
+				f.MemFS.dirs[dir] = true
+			}
+		}
+		for _, file := range f.MemFS.files {
+			file.mu.Lock()
+			file.data = append([]byte(nil), f.synced[file]...)
+			file.mu.Unlock()
+		}
+	}
+	f.MemFS.locks = make(map[string]*memLockState)
+	f.failAt, f.failed = 0, false
+}
+
+func (f *FaultFS) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	if _, err := f.step(); err != nil {
+		return nil, err
+	}
+	mf, err := f.MemFS.OpenFile(name, ioType)
+	if err != nil {
+		return nil, err
+	}
+	return &faultFile{fs: f, MemFile: mf.(*MemFile)}, nil
+}
+
+// 写入之后立即持久化，短写时只写入一半且不持久化
+func (f *FaultFS) WriteFile(name string, data []byte) error {
+	short, err := f.step()
+	if err != nil {
+		if short {
+			_ = f.MemFS.WriteFile(name, data[:len(data)/2])
+		}
+		return err
+	}
+	if err := f.MemFS.WriteFile(name, data); err != nil {
+		return err
+	}
+
+	f.MemFS.mu.Lock()
+	file := f.MemFS.files[filepath.Clean(name)]
+	f.MemFS.mu.Unlock()
+	f.sync(file)
+	return nil
+}
+
+func (f *FaultFS) MkdirAll(dir string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	return f.MemFS.MkdirAll(dir)
+}
+
+func (f *FaultFS) Remove(name string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	return f.MemFS.Remove(name)
+}
+
+func (f *FaultFS) RemoveAll(name string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	return f.MemFS.RemoveAll(name)
+}
+
+func (f *FaultFS) Rename(oldName, newName string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	return f.MemFS.Rename(oldName, newName)
+}
+
+// 记录目录中当前的文件项已经持久化
+func (f *FaultFS) SyncDir(dir string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.MemFS.mu.Lock()
+	defer f.MemFS.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	for path := range f.durable {
+		if filepath.Dir(path) == dir {
+			delete(f.durable, path)
+		}
+	}
+	for path, file := range f.MemFS.files {
+		if filepath.Dir(path) == dir {
+			f.durable[path] = file
+		}
+	}
+	return nil
+}
+
+func (f *FaultFS) Truncate(name string, size int64) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	f.MemFS.mu.Lock()
+	file := f.MemFS.files[filepath.Clean(name)]
+	f.MemFS.mu.Unlock()
+	if err := f.MemFS.Truncate(name, size); err != nil {
+		return err
+	}
+	f.truncateSynced(file, size)
+	return nil
+}
+
+func (f *FaultFS) Link(oldName, newName string) error {
+	if _, err := f.step(); err != nil {
+		return err
+	}
+	return f.MemFS.Link(oldName, newName)
+}
+
+// 记录一个IO步骤，到达注入故障的步骤时返回错误，short表示是否需要短写
+func (f *FaultFS) step() (short bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failed {
+		return false, ErrInjectedFault
+	}
+	f.steps++
+	if f.failAt > 0 && f.steps == f.failAt {
+		f.failed = true
+		return f.kind == FaultShortWrite, ErrInjectedFault
+	}
+	return false, nil
+}
+
+// 记录文件当前的内容已经持久化
+func (f *FaultFS) sync(file *memFile) {
+	file.mu.RLock()
+	data := append([]byte(nil), file.data...)
+	file.mu.RUnlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.synced[file] = data
+}
+
+// 截断文件立即持久化，已经持久化的内容也被截断
+func (f *FaultFS) truncateSynced(file *memFile, size int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if data, ok := f.synced[file]; ok && int64(len(data)) > size {
+		f.synced[file] = data[:size]
+	}
+}
+
+// 注入故障的文件，每次写入、持久化和截断都是一个IO步骤
+type faultFile struct {
+	*MemFile
+	fs *FaultFS
+}
+
+func (ff *faultFile) Write(b []byte) (int, error) {
+	short, err := ff.fs.step()
+	if err != nil {
+		if short {
+			n, _ := ff.MemFile.Write(b[:len(b)/2])
+			return n, err
+		}
+		return 0, err
+	}
+	return ff.MemFile.Write(b)
+}
+
+func (ff *faultFile) Sync() error {
+	if _, err := ff.fs.step(); err != nil {
+		return err
+	}
+	ff.fs.sync(ff.file)
+	return nil
+}
+
+func (ff *faultFile) Truncate(size int64) error {
+	if _, err := ff.fs.step(); err != nil {
+		return err
+	}
+	if err := ff.MemFile.Truncate(size); err != nil {
+		return err
+	}
+	ff.fs.truncateSynced(ff.file, size)
+	return nil
+}
@@ -0,0 +1,88 @@
+package fio
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultFS_Inject(t *testing.T) {
+	fsys := NewFaultFS()
+	assert.Nil(t, fsys.MkdirAll("/fault"))
+	f, err := fsys.OpenFile("/fault/a.data", StandardFIO)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fsys.Steps())
+
+	// 第二次写入时短写
+	fsys.InjectAfter(2, FaultShortWrite)
+	_, err = f.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	n, err := f.Write([]byte("kvkv"))
+	assert.Equal(t, ErrInjectedFault, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, fsys.Failed())
+
+	// 注入故障之后所有修改操作都返回错误
+	assert.Equal(t, ErrInjectedFault, f.Sync())
+	assert.Equal(t, ErrInjectedFault, fsys.Rename("/fault/a.data", "/fault/b.data"))
+	_, err = fsys.Stat("/fault/a.data")
+	assert.Nil(t, err)
+
+	fsys.Crash(false)
+	assert.False(t, fsys.Failed())
+	size, err := f.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), size)
+}
+
+func TestFaultFS_Crash(t *testing.T) {
+	fsys := NewFaultFS()
+	assert.Nil(t, fsys.MkdirAll("/fault"))
+	f, err := fsys.OpenFile("/fault/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+	assert.Nil(t, f.Sync())
+	_, err = f.Write([]byte(" kv"))
+	assert.Nil(t, err)
+
+	// WriteFile写入之后立即持久化内容
+	assert.Nil(t, fsys.WriteFile("/fault/b.data", []byte("synced")))
+	assert.Nil(t, fsys.SyncDir("/fault"))
+
+	// SyncDir之后的创建、重命名和删除没有持久化
+	assert.Nil(t, fsys.WriteFile("/fault/c.data", []byte("unsynced dir")))
+	assert.Nil(t, fsys.Rename("/fault/b.data", "/fault/d.data"))
+	assert.Nil(t, fsys.Remove("/fault/a.data"))
+	assert.Nil(t, fsys.MkdirAll("/fault/sub"))
+	assert.Nil(t, fsys.WriteFile("/fault/sub/e.data", []byte("synced dir")))
+	assert.Nil(t, fsys.SyncDir("/fault/sub"))
+	assert.Nil(t, fsys.RemoveAll("/fault/sub"))
+
+	// 掉电之后只保留已经持久化的内容和文件项
+	fsys.Crash(true)
+	buf, err := fsys.ReadFile("/fault/a.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), buf)
+	buf, err = fsys.ReadFile("/fault/b.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("synced"), buf)
+	_, err = fsys.Stat("/fault/c.data")
+	assert.True(t, os.IsNotExist(err))
+	_, err = fsys.Stat("/fault/d.data")
+	assert.True(t, os.IsNotExist(err))
+	buf, err = fsys.ReadFile("/fault/sub/e.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("synced dir"), buf)
+
+	// 崩溃之后释放文件锁
+	lock := fsys.NewLock("/fault/flock")
+	hold, err := lock.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+	fsys.Crash(false)
+	hold, err = fsys.NewLock("/fault/flock").TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+}
@@ -42,3 +42,8 @@ func (fio *FileIO) Size() (int64, error) {
 
 	return stat.Size(), nil
 }
+
+// 截断文件，之后的写入从文件末尾继续追加
+func (fio *FileIO) Truncate(size int64) error {
+	return fio.fd.Truncate(size)
+}
@@ -8,6 +8,14 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// 支持写入的IOManager类型，通用的读写测试对每种类型都执行一遍
+var writableIOTypes = map[string]FileIOType{
+	"FileIO":     StandardFIO,
+	"MMapRW":     MemoryMapRW,
+	"BufferedIO": BufferedFIO,
+	"IOUring":    IOUringFIO,
+}
+
 func destroyFile(name string) {
 	if err := os.RemoveAll(name); err != nil {
 		panic(err)
@@ -15,66 +23,95 @@ func destroyFile(name string) {
 }
 
 func TestNewFileIOManager(t *testing.T) {
-	path := filepath.Join("/tmp", "a.data")
-	fio, err := NewFileIOManager(path)
-	defer destroyFile(path)
-	assert.Nil(t, err)
-	assert.NotNil(t, fio)
+	for name, typ := range writableIOTypes {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.data")
+			fio, err := NewIOManager(path, typ)
+			defer destroyFile(path)
+			assert.Nil(t, err)
+			assert.NotNil(t, fio)
+			assert.Nil(t, fio.Close())
+		})
+	}
 }
 
 func TestFileIO_Write(t *testing.T) {
-	path := filepath.Join("/tmp", "a.data")
-	fio, err := NewFileIOManager(path)
-	defer destroyFile(path)
-	assert.Nil(t, err)
-	assert.NotNil(t, fio)
-	n, err := fio.Write([]byte(""))
-	assert.Equal(t, 0, n)
-	assert.Nil(t, err)
-	n, err = fio.Write([]byte("bitcask kv"))
-	assert.Equal(t, 10, n)
-	assert.Nil(t, err)
-	n, err = fio.Write([]byte("storage"))
-	assert.Equal(t, 7, n)
-	assert.Nil(t, err)
+	for name, typ := range writableIOTypes {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.data")
+			fio, err := NewIOManager(path, typ)
+			defer destroyFile(path)
+			assert.Nil(t, err)
+			assert.NotNil(t, fio)
+			defer fio.Close()
+			n, err := fio.Write([]byte(""))
+			assert.Equal(t, 0, n)
+			assert.Nil(t, err)
+			n, err = fio.Write([]byte("bitcask kv"))
+			assert.Equal(t, 10, n)
+			assert.Nil(t, err)
+			n, err = fio.Write([]byte("storage"))
+			assert.Equal(t, 7, n)
+			assert.Nil(t, err)
+			size, err := fio.Size()
+			assert.Nil(t, err)
+			assert.Equal(t, int64(17), size)
+		})
+	}
 }
 
 func TestFileIO_Read(t *testing.T) {
-	path := filepath.Join("/tmp", "a.data")
-	fio, err := NewFileIOManager(path)
-	defer destroyFile(path)
-	assert.Nil(t, err)
-	assert.NotNil(t, fio)
-	_, err = fio.Write([]byte("key-a"))
-	assert.Nil(t, err)
-	_, err = fio.Write([]byte("key-b"))
-	assert.Nil(t, err)
-	b1 := make([]byte, 5)
-	n, err := fio.Read(b1, 0)
-	assert.Equal(t, 5, n)
-	assert.Equal(t, []byte("key-a"), b1)
-	b2 := make([]byte, 5)
-	n, err = fio.Read(b2, 5)
-	assert.Equal(t, 5, n)
-	assert.Equal(t, []byte("key-b"), b2)
+	for name, typ := range writableIOTypes {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.data")
+			fio, err := NewIOManager(path, typ)
+			defer destroyFile(path)
+			assert.Nil(t, err)
+			assert.NotNil(t, fio)
+			defer fio.Close()
+			_, err = fio.Write([]byte("key-a"))
+			assert.Nil(t, err)
+			_, err = fio.Write([]byte("key-b"))
+			assert.Nil(t, err)
+			b1 := make([]byte, 5)
+			n, err := fio.Read(b1, 0)
+			assert.Nil(t, err)
+			assert.Equal(t, 5, n)
+			assert.Equal(t, []byte("key-a"), b1)
+			b2 := make([]byte, 5)
+			n, err = fio.Read(b2, 5)
+			assert.Nil(t, err)
+			assert.Equal(t, 5, n)
+			assert.Equal(t, []byte("key-b"), b2)
+		})
+	}
 }
 
 func TestFileIO_Sync(t *testing.T) {
-	path := filepath.Join("/tmp", "a.data")
-	fio, err := NewFileIOManager(path)
-	defer destroyFile(path)
-	assert.Nil(t, err)
-	assert.NotNil(t, fio)
-	err = fio.Sync()
-	assert.Nil(t, err)
+	for name, typ := range writableIOTypes {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.data")
+			fio, err := NewIOManager(path, typ)
+			defer destroyFile(path)
+			assert.Nil(t, err)
+			assert.NotNil(t, fio)
+			defer fio.Close()
+			err = fio.Sync()
+			assert.Nil(t, err)
+		})
+	}
 }
 
 func TestFileIO_Close(t *testing.T) {
-	path := filepath.Join("/tmp", "a.data")
-	fio, err := NewFileIOManager(path)
-	defer destroyFile(path)
-	assert.Nil(t, err)
-	assert.NotNil(t, fio)
-	err = fio.Close()
-	assert.Nil(t, err)
+	for name, typ := range writableIOTypes {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join("/tmp", "a.data")
+			fio, err := NewIOManager(path, typ)
+			defer destroyFile(path)
+			assert.Nil(t, err)
+			assert.NotNil(t, fio)
+			err = fio.Close()
+			assert.Nil(t, err)
+		})
+	}
 }
@@ -0,0 +1,225 @@
+package fio
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/gofrs/flock"
+)
+
+// 数据目录所在的文件系统，数据库的所有文件操作都通过它完成
+type FS interface {
+	// 以指定的IO类型打开文件，不存在时创建
+	OpenFile(name string, ioType FileIOType) (IOManager, error)
+
+	ReadFile(name string) ([]byte, error)
+
+	// 写入文件并持久化，文件已存在时覆盖
+	WriteFile(name string, data []byte) error
+
+	Stat(name string) (os.FileInfo, error)
+
+	ReadDir(dir string) ([]os.DirEntry, error)
+
+	MkdirAll(dir string) error
+
+	Remove(name string) error
+
+	RemoveAll(name string) error
+
+	Rename(oldName, newName string) error
+
+	// 持久化目录中文件的创建、重命名和删除
+	SyncDir(dir string) error
+
+	Truncate(name string, size int64) error
+
+	// 创建硬链接，不支持时返回错误
+	Link(oldName, newName string) error
+
+	// 目录所在位置的剩余可用空间
+	AvailableSize(dir string) (uint64, error)
+
+	// 创建文件锁
+	NewLock(name string) FileLock
+}
+
+// 文件锁，排他锁保证数据目录只被单进程写入，共享锁用于只读进程
+type FileLock interface {
+	TryLock() (bool, error)
+	RLock() error
+	Unlock() error
+}
+
+// 操作系统的文件系统
+type OSFS struct{}
+
+func (OSFS) OpenFile(name string, ioType FileIOType) (IOManager, error) {
+	return NewIOManager(name, ioType)
+}
+
+func (OSFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFS) WriteFile(name string, data []byte) error {
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, DataFilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) ReadDir(dir string) ([]os.DirEntry, error) {
+	return os.ReadDir(dir)
+}
+
+func (OSFS) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (OSFS) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (OSFS) Truncate(name string, size int64) error {
+	return os.Truncate(name, size)
+}
+
+func (OSFS) Link(oldName, newName string) error {
+	return os.Link(oldName, newName)
+}
+
+func (OSFS) NewLock(name string) FileLock {
+	return flock.New(name)
+}
+
+// 获取文件的inode，增量备份据此判断文件是否被替换，无法获取时返回0
+func Inode(info os.FileInfo) uint64 {
+	if fi, ok := info.(*memFileInfo); ok {
+		return fi.ino
+	}
+	return osInode(info)
+}
+
+// 获取目录中所有文件的总大小
+func DirSize(fsys FS, dir string) (int64, error) {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			n, err := DirSize(fsys, filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return 0, err
+			}
+			size += n
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
+
+// 拷贝目录，跳过名称在exclude中的文件，每拷贝一个文件前检查ctx是否已经取消
+func CopyDir(ctx context.Context, fsys FS, src, dst string, exclude []string) error {
+	if err := fsys.MkdirAll(dst); err != nil {
+		return err
+	}
+
+	entries, err := fsys.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+next:
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, e := range exclude {
+			if entry.Name() == e {
+				continue next
+			}
+		}
+
+		srcPath, dstPath := filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())
+		if entry.IsDir() {
+			if err := CopyDir(ctx, fsys, srcPath, dstPath, exclude); err != nil {
+				return err
+			}
+			continue
+		}
+
+		buf, err := fsys.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		if err := fsys.WriteFile(dstPath, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 拷贝文件中 [start, end) 范围内的数据到目标文件的相同位置，目标文件在start之后的数据会被覆盖
+func CopyFileRange(fsys FS, src, dst string, start, end int64) error {
+	srcFile, err := fsys.OpenFile(src, StandardFIO)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := fsys.OpenFile(dst, StandardFIO)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	if err := dstFile.Truncate(start); err != nil {
+		return err
+	}
+
+	buf := make([]byte, min(end-start, 1024*1024))
+	for offset := start; offset < end; {
+		n := min(int64(len(buf)), end-offset)
+		if _, err := srcFile.Read(buf[:n], offset); err != nil {
+			return err
+		}
+		if _, err := dstFile.Write(buf[:n]); err != nil {
+			return err
+		}
+		offset += n
+	}
+
+	return dstFile.Sync()
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package fio
+
+import "os"
+
+// 非unix平台无法打开目录执行同步，目录项的持久化由文件系统保证
+func (OSFS) SyncDir(dir string) error {
+	return nil
+}
+
+// 非unix平台没有inode，增量备份只根据文件大小判断文件是否变化
+func osInode(info os.FileInfo) uint64 {
+	return 0
+}
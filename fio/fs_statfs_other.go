@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package fio
+
+import "math"
+
+// 无法通过statfs获取剩余空间的平台，merge时不做检查
+func (OSFS) AvailableSize(dir string) (uint64, error) {
+	return math.MaxUint64, nil
+}
@@ -7,6 +7,10 @@ type FileIOType uint8
 const (
 	StandardFIO FileIOType = iota
 	MemoryMap
+	MemoryMapRW // 可读写的内存映射
+	BufferedFIO // 带写缓冲的文件IO
+	DirectFIO   // 绕过页缓存的直接IO
+	IOUringFIO  // 基于io_uring的文件IO，内核不支持时退化为FileIO
 )
 
 // 抽象 IO 管理接口，可以接入不同的 IO 类型
@@ -24,16 +28,64 @@ type IOManager interface {
 	Close() error
 
 	Size() (int64, error)
+
+	// 截断文件，丢弃size之后的数据
+	Truncate(size int64) error
+}
+
+// 支持预分配空间的IOManager
+type Preallocator interface {
+	Preallocate(size int64) error
 }
 
-// 初始化IOManager，目前支持FileIO
+// 初始化IOManager，支持FileIO、只读MMap、可读写MMap、带写缓冲的FileIO、直接IO和io_uring
 func NewIOManager(fileName string, ioType FileIOType) (IOManager, error) {
 	switch ioType {
 	case StandardFIO:
 		return NewFileIOManager(fileName)
 	case MemoryMap:
 		return NewMMapIOManager(fileName)
+	case MemoryMapRW:
+		return NewMMapRWIOManager(fileName)
+	case BufferedFIO:
+		return NewBufferedFileIOManager(fileName)
+	case DirectFIO:
+		return NewDirectIOManager(fileName)
+	case IOUringFIO:
+		return NewIOUringIOManager(fileName)
 	default:
 		panic("unsupported FileIO Type")
 	}
 }
+
+// 批量读取中的一个请求，读取结果写入N和Err
+type ReadRequest struct {
+	IO     IOManager
+	Buf    []byte
+	Offset int64
+	N      int
+	Err    error
+}
+
+// 支持一次提交多个读请求的IOManager
+type batchReader interface {
+	readBatch(reqs []*ReadRequest)
+}
+
+// 批量读取，支持批量提交的IOManager上的请求一次提交，其余的依次读取
+func ReadBatch(reqs []*ReadRequest) {
+	var reader batchReader
+	batch := make([]*ReadRequest, 0, len(reqs))
+	for _, req := range reqs {
+		if br, ok := req.IO.(batchReader); ok {
+			reader = br
+			batch = append(batch, req)
+			continue
+		}
+		req.N, req.Err = req.IO.Read(req.Buf, req.Offset)
+	}
+
+	if len(batch) > 0 {
+		reader.readBatch(batch)
+	}
+}
@@ -0,0 +1,380 @@
+//go:build linux
+
+package fio
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	uringEntries = 64 // 一次最多同时提交的请求数
+
+	uringOpReadv = 1
+
+	uringEnterGetEvents = 1
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+)
+
+// 与内核中 struct io_uring_params 的布局一致
+type uringParams struct {
+	sqEntries    uint32
+	cqEntries    uint32
+	flags        uint32
+	sqThreadCPU  uint32
+	sqThreadIdle uint32
+	features     uint32
+	wqFd         uint32
+	resv         [3]uint32
+	sqOff        uringSQOffsets
+	cqOff        uringCQOffsets
+}
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+// 与内核中 struct io_uring_sqe 的布局一致
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+// 与内核中 struct io_uring_cqe 的布局一致
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// 一组提交和完成队列，同一时刻只属于一个提交者
+type uring struct {
+	fd      int
+	mmaps   [][]byte // 映射的队列内存，关闭时解除映射
+	sqHead  *uint32
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []uringSQE
+	cqHead  *uint32
+	cqTail  *uint32
+	cqMask  uint32
+	cqes    []uringCQE
+}
+
+// 一次读写请求，res为内核返回的结果
+type uringOp struct {
+	opcode uint8
+	fd     int
+	buf    []byte
+	offset int64
+	res    int32
+}
+
+// io_uring池，每个提交者独占一个ring，不同协程的批量读取可以同时进行
+// ring的数量不超过GOMAXPROCS，创建之后一直复用，出错的ring关闭之后可以重新创建
+type uringPool struct {
+	once  sync.Once
+	err   error // 内核不支持io_uring
+	mu    sync.Mutex
+	count int
+	free  chan *uring
+}
+
+var ringPool uringPool
+
+// 检查内核是否支持io_uring，创建的第一个ring放入池中
+func (p *uringPool) init() error {
+	p.once.Do(func() {
+		p.free = make(chan *uring, runtime.GOMAXPROCS(0))
+		ring, err := newUring(uringEntries)
+		if err != nil {
+			p.err = err
+			return
+		}
+		p.count = 1
+		p.free <- ring
+	})
+	return p.err
+}
+
+// 取出一个空闲的ring，没有空闲且未达到上限时新建，否则等待其他提交者归还
+func (p *uringPool) get() (*uring, error) {
+	select {
+	case ring := <-p.free:
+		return ring, nil
+	default:
+	}
+
+	p.mu.Lock()
+	if p.count < cap(p.free) {
+		ring, err := newUring(uringEntries)
+		if err == nil {
+			p.count++
+			p.mu.Unlock()
+			return ring, nil
+		}
+		// 创建失败（例如超过锁定内存的限制）时等待已有的ring，没有可等待的ring时返回错误
+		if p.count == 0 {
+			p.mu.Unlock()
+			return nil, err
+		}
+	}
+	p.mu.Unlock()
+	return <-p.free, nil
+}
+
+func (p *uringPool) put(ring *uring) {
+	p.free <- ring
+}
+
+// 提交或等待出错的ring中可能还有未完成的请求，关闭之后不再放回池中
+func (p *uringPool) discard(ring *uring) {
+	ring.close()
+	p.mu.Lock()
+	p.count--
+	p.mu.Unlock()
+}
+
+func newUring(entries uint32) (*uring, error) {
+	var params uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&params)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	ring := &uring{fd: int(fd)}
+	sqRing, err := unix.Mmap(ring.fd, uringOffSQRing, int(params.sqOff.array+params.sqEntries*4),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		_ = unix.Close(ring.fd)
+		return nil, err
+	}
+	ring.mmaps = append(ring.mmaps, sqRing)
+	cqRing, err := unix.Mmap(ring.fd, uringOffCQRing, int(params.cqOff.cqes+params.cqEntries*uint32(unsafe.Sizeof(uringCQE{}))),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		ring.close()
+		return nil, err
+	}
+	ring.mmaps = append(ring.mmaps, cqRing)
+	sqeMem, err := unix.Mmap(ring.fd, uringOffSQEs, int(params.sqEntries*uint32(unsafe.Sizeof(uringSQE{}))),
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		ring.close()
+		return nil, err
+	}
+	ring.mmaps = append(ring.mmaps, sqeMem)
+
+	ring.sqHead = (*uint32)(unsafe.Pointer(&sqRing[params.sqOff.head]))
+	ring.sqTail = (*uint32)(unsafe.Pointer(&sqRing[params.sqOff.tail]))
+	ring.sqMask = *(*uint32)(unsafe.Pointer(&sqRing[params.sqOff.ringMask]))
+	ring.sqArray = unsafe.Slice((*uint32)(unsafe.Pointer(&sqRing[params.sqOff.array])), params.sqEntries)
+	ring.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&sqeMem[0])), params.sqEntries)
+	ring.cqHead = (*uint32)(unsafe.Pointer(&cqRing[params.cqOff.head]))
+	ring.cqTail = (*uint32)(unsafe.Pointer(&cqRing[params.cqOff.tail]))
+	ring.cqMask = *(*uint32)(unsafe.Pointer(&cqRing[params.cqOff.ringMask]))
+	ring.cqes = unsafe.Slice((*uringCQE)(unsafe.Pointer(&cqRing[params.cqOff.cqes])), params.cqEntries)
+	return ring, nil
+}
+
+// 解除队列内存的映射并关闭ring
+func (r *uring) close() {
+	for _, mem := range r.mmaps {
+		_ = unix.Munmap(mem)
+	}
+	r.mmaps = nil
+	_ = unix.Close(r.fd)
+}
+
+// 提交一批请求并等待全部完成，超过队列长度时分多次提交
+func (r *uring) submit(ops []*uringOp) error {
+	for start := 0; start < len(ops); start += len(r.sqes) {
+		if err := r.submitBatch(ops[start:min(start+len(r.sqes), len(ops))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *uring) submitBatch(ops []*uringOp) error {
+	iovecs := make([]unix.Iovec, len(ops))
+	tail := *r.sqTail
+	for i, op := range ops {
+		if len(op.buf) > 0 {
+			iovecs[i].Base = &op.buf[0]
+		}
+		iovecs[i].SetLen(len(op.buf))
+
+		idx := (tail + uint32(i)) & r.sqMask
+		r.sqes[idx] = uringSQE{
+			opcode:   op.opcode,
+			fd:       int32(op.fd),
+			off:      uint64(op.offset),
+			addr:     uint64(uintptr(unsafe.Pointer(&iovecs[i]))),
+			len:      1,
+			userData: uint64(i),
+		}
+		r.sqArray[idx] = idx
+	}
+	atomic.StoreUint32(r.sqTail, tail+uint32(len(ops)))
+
+	toSubmit, completed := len(ops), 0
+	for completed < len(ops) {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), 1, uringEnterGetEvents, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		toSubmit -= int(n)
+
+		// 取出已经完成的请求
+		head := atomic.LoadUint32(r.cqHead)
+		for cqTail := atomic.LoadUint32(r.cqTail); head != cqTail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+			ops[cqe.userData].res = cqe.res
+			completed++
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+
+	// 内核使用的缓冲区在完成之前不能被回收
+	runtime.KeepAlive(iovecs)
+	runtime.KeepAlive(ops)
+	return nil
+}
+
+// 基于io_uring的文件IO，多个读请求可以一次提交
+// 单次的读写直接使用pread和pwrite，提交到io_uring没有收益
+type IOUring struct {
+	mu   *sync.Mutex // 保护写入位置
+	fd   *os.File
+	size int64
+}
+
+// 内核不支持io_uring时退化为FileIO
+func NewIOUringIOManager(fileName string) (IOManager, error) {
+	if err := ringPool.init(); err != nil {
+		return NewFileIOManager(fileName)
+	}
+
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return &IOUring{mu: new(sync.Mutex), fd: fd, size: stat.Size()}, nil
+}
+
+func (u *IOUring) Read(b []byte, offset int64) (int, error) {
+	return u.fd.ReadAt(b, offset)
+}
+
+// 在文件末尾追加写入
+func (u *IOUring) Write(b []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	n, err := u.fd.WriteAt(b, u.size)
+	u.size += int64(n)
+	return n, err
+}
+
+func (u *IOUring) Sync() error {
+	return u.fd.Sync()
+}
+
+func (u *IOUring) Close() error {
+	return u.fd.Close()
+}
+
+func (u *IOUring) Size() (int64, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.size, nil
+}
+
+func (u *IOUring) Truncate(size int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.fd.Truncate(size); err != nil {
+		return err
+	}
+	u.size = size
+	return nil
+}
+
+// 从池中取出一个ring，将所有请求一次提交，读到的数据不足时按ReadAt的语义补读
+func (u *IOUring) readBatch(reqs []*ReadRequest) {
+	ops := make([]*uringOp, len(reqs))
+	for i, req := range reqs {
+		ops[i] = &uringOp{opcode: uringOpReadv, fd: int(req.IO.(*IOUring).fd.Fd()), buf: req.Buf, offset: req.Offset}
+	}
+
+	ring, err := ringPool.get()
+	if err == nil {
+		if err = ring.submit(ops); err != nil {
+			ringPool.discard(ring)
+		} else {
+			ringPool.put(ring)
+		}
+	}
+	if err != nil {
+		for _, req := range reqs {
+			req.N, req.Err = 0, err
+		}
+		return
+	}
+
+	for i, req := range reqs {
+		res := ops[i].res
+		switch {
+		case res < 0:
+			req.N, req.Err = 0, syscall.Errno(-res)
+		case int(res) < len(req.Buf):
+			file := req.IO.(*IOUring).fd
+			n, err := file.ReadAt(req.Buf[res:], req.Offset+int64(res))
+			req.N, req.Err = int(res)+n, err
+			if req.Err == nil && req.N < len(req.Buf) {
+				req.Err = io.EOF
+			}
+		default:
+			req.N, req.Err = int(res), nil
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fio
+
+// io_uring仅支持Linux，其他平台使用FileIO
+func NewIOUringIOManager(fileName string) (IOManager, error) {
+	return NewFileIOManager(fileName)
+}
@@ -0,0 +1,187 @@
+//go:build linux
+
+package fio
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestIOUring_ReadBatch(t *testing.T) {
+	if err := ringPool.init(); err != nil {
+		t.Skip("io_uring is not supported:", err)
+	}
+
+	path1 := filepath.Join("/tmp", "uring-1.data")
+	path2 := filepath.Join("/tmp", "uring-2.data")
+	defer destroyFile(path1)
+	defer destroyFile(path2)
+
+	io1, err := NewIOUringIOManager(path1)
+	assert.Nil(t, err)
+	assert.IsType(t, &IOUring{}, io1)
+	defer io1.Close()
+	io2, err := NewIOUringIOManager(path2)
+	assert.Nil(t, err)
+	defer io2.Close()
+
+	// 请求数超过队列长度，需要分多次提交
+	var reqs []*ReadRequest
+	for i := 0; i < uringEntries*2; i++ {
+		_, err := io1.Write([]byte(fmt.Sprintf("a-%04d", i)))
+		assert.Nil(t, err)
+		_, err = io2.Write([]byte(fmt.Sprintf("b-%04d", i)))
+		assert.Nil(t, err)
+		reqs = append(reqs,
+			&ReadRequest{IO: io1, Buf: make([]byte, 6), Offset: int64(i * 6)},
+			&ReadRequest{IO: io2, Buf: make([]byte, 6), Offset: int64(i * 6)},
+		)
+	}
+	ReadBatch(reqs)
+	for i := 0; i < uringEntries*2; i++ {
+		assert.Nil(t, reqs[i*2].Err)
+		assert.Equal(t, 6, reqs[i*2].N)
+		assert.Equal(t, fmt.Sprintf("a-%04d", i), string(reqs[i*2].Buf))
+		assert.Nil(t, reqs[i*2+1].Err)
+		assert.Equal(t, fmt.Sprintf("b-%04d", i), string(reqs[i*2+1].Buf))
+	}
+
+	// 与FileIO混合提交，读到文件末尾时返回EOF
+	path3 := filepath.Join("/tmp", "uring-3.data")
+	defer destroyFile(path3)
+	fileIO, err := NewFileIOManager(path3)
+	assert.Nil(t, err)
+	defer fileIO.Close()
+	_, err = fileIO.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+
+	size, err := io1.Size()
+	assert.Nil(t, err)
+	reqs = []*ReadRequest{
+		{IO: fileIO, Buf: make([]byte, 7), Offset: 0},
+		{IO: io1, Buf: make([]byte, 10), Offset: size - 6},
+	}
+	ReadBatch(reqs)
+	assert.Nil(t, reqs[0].Err)
+	assert.Equal(t, "bitcask", string(reqs[0].Buf))
+	assert.Equal(t, io.EOF, reqs[1].Err)
+	assert.Equal(t, 6, reqs[1].N)
+	assert.Equal(t, fmt.Sprintf("a-%04d", uringEntries*2-1), string(reqs[1].Buf[:6]))
+}
+
+func TestIOUring_ConcurrentReadBatch(t *testing.T) {
+	if err := ringPool.init(); err != nil {
+		t.Skip("io_uring is not supported:", err)
+	}
+
+	path := filepath.Join("/tmp", "uring-concurrent.data")
+	defer destroyFile(path)
+	uio, err := NewIOUringIOManager(path)
+	assert.Nil(t, err)
+	defer uio.Close()
+	for i := 0; i < uringEntries; i++ {
+		_, err := uio.Write([]byte(fmt.Sprintf("c-%04d", i)))
+		assert.Nil(t, err)
+	}
+
+	// 多个协程同时批量读取，各自使用池中的ring，结果互不干扰
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				reqs := make([]*ReadRequest, uringEntries)
+				for i := range reqs {
+					reqs[i] = &ReadRequest{IO: uio, Buf: make([]byte, 6), Offset: int64(i * 6)}
+				}
+				ReadBatch(reqs)
+				for i, req := range reqs {
+					assert.Nil(t, req.Err)
+					assert.Equal(t, fmt.Sprintf("c-%04d", i), string(req.Buf))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.True(t, ringPool.count <= cap(ringPool.free))
+}
+
+func TestIOUring_DiscardFailedRing(t *testing.T) {
+	if err := ringPool.init(); err != nil {
+		t.Skip("io_uring is not supported:", err)
+	}
+
+	path := filepath.Join("/tmp", "uring-discard.data")
+	defer destroyFile(path)
+	uio, err := NewIOUringIOManager(path)
+	assert.Nil(t, err)
+	defer uio.Close()
+	_, err = uio.Write([]byte("bitcask"))
+	assert.Nil(t, err)
+
+	// 取出所有空闲的ring，只放回一个无法提交的ring，下一次提交一定失败
+	var rings []*uring
+	for len(ringPool.free) > 0 {
+		rings = append(rings, <-ringPool.free)
+	}
+	count := ringPool.count
+	broken, err := newUring(uringEntries)
+	assert.Nil(t, err)
+	// 将ring的fd替换为普通文件，io_uring_enter返回错误
+	ringFd := broken.fd
+	broken.fd, err = unix.Open("/dev/null", unix.O_RDONLY, 0)
+	assert.Nil(t, err)
+	_ = unix.Close(ringFd)
+	ringPool.free <- broken
+
+	reqs := []*ReadRequest{{IO: uio, Buf: make([]byte, 7), Offset: 0}}
+	ReadBatch(reqs)
+	assert.NotNil(t, reqs[0].Err)
+	// 出错的ring被丢弃，不再放回池中
+	assert.Equal(t, 0, len(ringPool.free))
+	ringPool.mu.Lock()
+	ringPool.count = count
+	ringPool.mu.Unlock()
+
+	for _, ring := range rings {
+		ringPool.put(ring)
+	}
+	reqs = []*ReadRequest{{IO: uio, Buf: make([]byte, 7), Offset: 0}}
+	ReadBatch(reqs)
+	assert.Nil(t, reqs[0].Err)
+	assert.Equal(t, "bitcask", string(reqs[0].Buf))
+}
+
+func TestIOUring_Truncate(t *testing.T) {
+	path := filepath.Join("/tmp", "uring.data")
+	defer destroyFile(path)
+
+	uio, err := NewIOUringIOManager(path)
+	assert.Nil(t, err)
+	_, err = uio.Write([]byte("bitcask kv"))
+	assert.Nil(t, err)
+	err = uio.Truncate(7)
+	assert.Nil(t, err)
+	_, err = uio.Write([]byte("-go"))
+	assert.Nil(t, err)
+	assert.Nil(t, uio.Close())
+
+	// 重新打开之后从文件末尾继续追加
+	uio, err = NewIOUringIOManager(path)
+	assert.Nil(t, err)
+	defer uio.Close()
+	size, err := uio.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+	b := make([]byte, 10)
+	_, err = uio.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "bitcask-go", string(b))
+}
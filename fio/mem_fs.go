@@ -0,0 +1,437 @@
+package fio
+
+import (
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 内存文件系统，所有文件保存在内存中，实例关闭之后数据丢失
+// 同一个MemFS可以被多次打开，用于在不访问磁盘的情况下运行完整的存储引擎
+type MemFS struct {
+	mu      *sync.Mutex
+	files   map[string]*memFile // 文件路径到文件的映射，硬链接的多个路径指向同一个文件
+	dirs    map[string]bool
+	locks   map[string]*memLockState
+	nextIno uint64
+}
+
+// 内存中的文件，打开的多个MemFile共享同一份数据
+type memFile struct {
+	mu      *sync.RWMutex
+	data    []byte
+	ino     uint64
+	modTime time.Time
+}
+
+func NewMemFS() *MemFS {
+	return &MemFS{
+		mu:    new(sync.Mutex),
+		files: make(map[string]*memFile),
+		dirs:  make(map[string]bool),
+		locks: make(map[string]*memLockState),
+	}
+}
+
+// 以内存文件的方式打开，忽略IO类型
+func (m *MemFS) OpenFile(name string, _ FileIOType) (IOManager, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := m.openLocked(name)
+	if err != nil {
+		return nil, err
+	}
+	return &MemFile{file: file}, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	file, ok := m.files[filepath.Clean(name)]
+	m.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	file.mu.RLock()
+	defer file.mu.RUnlock()
+	return append([]byte(nil), file.data...), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := m.openLocked(name)
+	if err != nil {
+		return err
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	file.data = append([]byte(nil), data...)
+	file.modTime = time.Now()
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if info := m.statLocked(name); info != nil {
+		return info, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// 列出目录中的文件和子目录，按名称排序
+func (m *MemFS) ReadDir(dir string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	if !m.dirExistsLocked(dir) {
+		return nil, &os.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+
+	var entries []os.DirEntry
+	for name := range m.files {
+		if filepath.Dir(name) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(m.statLocked(name)))
+		}
+	}
+	for name := range m.dirs {
+		if name != dir && filepath.Dir(name) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(m.statLocked(name)))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *MemFS) MkdirAll(dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir = filepath.Clean(dir); !m.dirExistsLocked(dir); dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+		}
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+// 删除文件或空目录
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		// 与flock一样，删除路径之后已有的锁对象不再与新建的锁互斥
+		delete(m.files, name)
+		delete(m.locks, name)
+		return nil
+	}
+	if !m.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	for path := range m.files {
+		if isSubPath(path, name) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	for path := range m.dirs {
+		if isSubPath(path, name) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	delete(m.dirs, name)
+	delete(m.locks, name)
+	return nil
+}
+
+// 删除文件或目录及其中的所有文件，不存在时返回nil
+func (m *MemFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	for path := range m.files {
+		if path == name || isSubPath(path, name) {
+			delete(m.files, path)
+		}
+	}
+	for path := range m.dirs {
+		if path == name || isSubPath(path, name) {
+			delete(m.dirs, path)
+		}
+	}
+	for path := range m.locks {
+		if path == name || isSubPath(path, name) {
+			delete(m.locks, path)
+		}
+	}
+	return nil
+}
+
+// 重命名文件，目标文件已存在时被替换
+func (m *MemFS) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldName, newName = filepath.Clean(oldName), filepath.Clean(newName)
+	file, ok := m.files[oldName]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	if !m.dirExistsLocked(filepath.Dir(newName)) {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldName)
+	m.files[newName] = file
+	return nil
+}
+
+// 内存文件系统的目录操作不需要持久化
+func (m *MemFS) SyncDir(string) error {
+	return nil
+}
+
+func (m *MemFS) Truncate(name string, size int64) error {
+	m.mu.Lock()
+	file, ok := m.files[filepath.Clean(name)]
+	m.mu.Unlock()
+	if !ok {
+		return &os.PathError{Op: "truncate", Path: name, Err: fs.ErrNotExist}
+	}
+	return file.truncate(size)
+}
+
+// 硬链接的两个路径共享同一份数据
+func (m *MemFS) Link(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldName, newName = filepath.Clean(oldName), filepath.Clean(newName)
+	file, ok := m.files[oldName]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	if m.statLocked(newName) != nil {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: fs.ErrExist}
+	}
+	if !m.dirExistsLocked(filepath.Dir(newName)) {
+		return &os.LinkError{Op: "link", Old: oldName, New: newName, Err: fs.ErrNotExist}
+	}
+	m.files[newName] = file
+	return nil
+}
+
+// 内存文件系统不限制空间
+func (m *MemFS) AvailableSize(string) (uint64, error) {
+	return math.MaxUint64, nil
+}
+
+// 同一路径的锁在MemFS内共享状态，与flock一样，同一进程中不同的锁对象也互斥
+func (m *MemFS) NewLock(name string) FileLock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	state, ok := m.locks[name]
+	if !ok {
+		state = &memLockState{cond: sync.NewCond(new(sync.Mutex))}
+		m.locks[name] = state
+	}
+	return &memLock{state: state}
+}
+
+// 打开文件，不存在时创建，调用前必须持有互斥锁
+func (m *MemFS) openLocked(name string) (*memFile, error) {
+	name = filepath.Clean(name)
+	if file, ok := m.files[name]; ok {
+		return file, nil
+	}
+	if m.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if !m.dirExistsLocked(filepath.Dir(name)) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	m.nextIno++
+	file := &memFile{mu: new(sync.RWMutex), ino: m.nextIno, modTime: time.Now()}
+	m.files[name] = file
+	return file, nil
+}
+
+// 获取文件或目录的信息，不存在时返回nil，调用前必须持有互斥锁
+func (m *MemFS) statLocked(name string) os.FileInfo {
+	if file, ok := m.files[name]; ok {
+		file.mu.RLock()
+		defer file.mu.RUnlock()
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(file.data)), mode: DataFilePerm, modTime: file.modTime, ino: file.ino}
+	}
+	if m.dirExistsLocked(name) {
+		return &memFileInfo{name: filepath.Base(name), mode: fs.ModeDir | os.ModePerm}
+	}
+	return nil
+}
+
+// 根目录和当前目录总是存在
+func (m *MemFS) dirExistsLocked(dir string) bool {
+	return dir == "/" || dir == "." || m.dirs[dir]
+}
+
+// path是否在dir之下
+func isSubPath(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func (f *memFile) truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.modTime = time.Now()
+	return nil
+}
+
+// 内存文件的IOManager
+type MemFile struct {
+	file *memFile
+}
+
+func (mf *MemFile) Read(b []byte, offset int64) (int, error) {
+	mf.file.mu.RLock()
+	defer mf.file.mu.RUnlock()
+
+	if offset >= int64(len(mf.file.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, mf.file.data[offset:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 追加写入
+func (mf *MemFile) Write(b []byte) (int, error) {
+	mf.file.mu.Lock()
+	defer mf.file.mu.Unlock()
+
+	mf.file.data = append(mf.file.data, b...)
+	mf.file.modTime = time.Now()
+	return len(b), nil
+}
+
+func (mf *MemFile) Sync() error {
+	return nil
+}
+
+func (mf *MemFile) Close() error {
+	return nil
+}
+
+func (mf *MemFile) Size() (int64, error) {
+	mf.file.mu.RLock()
+	defer mf.file.mu.RUnlock()
+	return int64(len(mf.file.data)), nil
+}
+
+func (mf *MemFile) Truncate(size int64) error {
+	return mf.file.truncate(size)
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	ino     uint64
+}
+
+func (fi *memFileInfo) Name() string       { return fi.name }
+func (fi *memFileInfo) Size() int64        { return fi.size }
+func (fi *memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi *memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+
+// inode通过Inode获取
+func (fi *memFileInfo) Sys() any {
+	return nil
+}
+
+// 同一路径上所有锁对象共享的状态
+type memLockState struct {
+	cond      *sync.Cond
+	exclusive bool
+	readers   int
+}
+
+type memLock struct {
+	state  *memLockState
+	held   bool
+	shared bool
+}
+
+func (l *memLock) TryLock() (bool, error) {
+	l.state.cond.L.Lock()
+	defer l.state.cond.L.Unlock()
+
+	if l.held {
+		return !l.shared, nil
+	}
+	if l.state.exclusive || l.state.readers > 0 {
+		return false, nil
+	}
+	l.state.exclusive, l.held, l.shared = true, true, false
+	return true, nil
+}
+
+// 获取共享锁，有排他锁时等待
+func (l *memLock) RLock() error {
+	l.state.cond.L.Lock()
+	defer l.state.cond.L.Unlock()
+
+	if l.held {
+		return nil
+	}
+	for l.state.exclusive {
+		l.state.cond.Wait()
+	}
+	l.state.readers++
+	l.held, l.shared = true, true
+	return nil
+}
+
+func (l *memLock) Unlock() error {
+	l.state.cond.L.Lock()
+	defer l.state.cond.L.Unlock()
+
+	if !l.held {
+		return nil
+	}
+	if l.shared {
+		l.state.readers--
+	} else {
+		l.state.exclusive = false
+	}
+	l.held = false
+	l.state.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,117 @@
+package fio
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemFS_File(t *testing.T) {
+	fsys := NewMemFS()
+
+	// 父目录不存在
+	_, err := fsys.OpenFile("/mem/a.data", StandardFIO)
+	assert.True(t, os.IsNotExist(err))
+
+	err = fsys.MkdirAll("/mem/sub")
+	assert.Nil(t, err)
+	f1, err := fsys.OpenFile("/mem/a.data", StandardFIO)
+	assert.Nil(t, err)
+	_, err = f1.Write([]byte("bitcask kv"))
+	assert.Nil(t, err)
+
+	// 多次打开共享同一份数据
+	f2, err := fsys.OpenFile("/mem/a.data", MemoryMapRW)
+	assert.Nil(t, err)
+	b := make([]byte, 7)
+	n, err := f2.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, []byte("bitcask"), b)
+	_, err = f2.Read(b, 8)
+	assert.Equal(t, io.EOF, err)
+
+	err = f1.Truncate(7)
+	assert.Nil(t, err)
+	size, err := f2.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), size)
+
+	err = fsys.WriteFile("/mem/b.data", []byte("value"))
+	assert.Nil(t, err)
+	entries, err := fsys.ReadDir("/mem")
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"a.data", "b.data", "sub"}, names)
+	assert.True(t, entries[2].IsDir())
+
+	// 硬链接共享数据，重命名之后原路径不存在
+	err = fsys.Link("/mem/a.data", "/mem/sub/c.data")
+	assert.Nil(t, err)
+	err = fsys.Rename("/mem/a.data", "/mem/d.data")
+	assert.Nil(t, err)
+	_, err = fsys.Stat("/mem/a.data")
+	assert.True(t, os.IsNotExist(err))
+	_, err = f1.Write([]byte("-go"))
+	assert.Nil(t, err)
+	buf, err := fsys.ReadFile("/mem/sub/c.data")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask-go"), buf)
+	info, err := fsys.Stat("/mem/d.data")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), info.Size())
+
+	size2, err := DirSize(fsys, "/mem")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(25), size2)
+
+	// 非空目录只能通过RemoveAll删除
+	err = fsys.Remove("/mem/sub")
+	assert.NotNil(t, err)
+	err = fsys.RemoveAll("/mem")
+	assert.Nil(t, err)
+	_, err = fsys.ReadDir("/mem")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemFS_Lock(t *testing.T) {
+	fsys := NewMemFS()
+	l1, l2 := fsys.NewLock("/mem/flock"), fsys.NewLock("/mem/flock")
+
+	hold, err := l1.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+	hold, err = l2.TryLock()
+	assert.Nil(t, err)
+	assert.False(t, hold)
+
+	// 共享锁等待排他锁释放
+	locked := make(chan struct{})
+	go func() {
+		_ = l2.RLock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("shared lock acquired while exclusive lock is held")
+	case <-time.After(50 * time.Millisecond):
+	}
+	err = l1.Unlock()
+	assert.Nil(t, err)
+	<-locked
+
+	hold, err = l1.TryLock()
+	assert.Nil(t, err)
+	assert.False(t, hold)
+	err = l2.Unlock()
+	assert.Nil(t, err)
+	hold, err = l1.TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+}
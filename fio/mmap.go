@@ -37,6 +37,11 @@ func (m *MMap) Sync() error {
 	panic("not implemented")
 }
 
+// 不需要
+func (m *MMap) Truncate(size int64) error {
+	panic("not implemented")
+}
+
 // 关闭文件
 func (m *MMap) Close() error {
 	return m.readerAt.Close()
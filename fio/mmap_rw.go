@@ -0,0 +1,152 @@
+//go:build unix
+
+package fio
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// 写入时每次至少预分配的空间
+const mmapGrowSize = 4 * 1024 * 1024
+
+// 可读写的MMap IO，写入超出映射区域时扩展文件并重新映射
+type MMapRW struct {
+	mu   *sync.RWMutex // 重新映射时阻塞读
+	fd   *os.File
+	data []byte // 映射区域，长度即文件在磁盘上的大小，包含预分配的空间
+	size int64  // 已经写入的数据大小
+}
+
+func NewMMapRWIOManager(fileName string) (*MMapRW, error) {
+	fd, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+
+	// 打开时只映射已有的数据，旧的数据文件不会被扩展
+	m := &MMapRW{mu: new(sync.RWMutex), fd: fd, size: stat.Size()}
+	if err := m.remap(stat.Size()); err != nil {
+		_ = fd.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MMapRW) Read(buf []byte, offset int64) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if offset >= m.size {
+		return 0, io.EOF
+	}
+	n := copy(buf, m.data[offset:m.size])
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// 追加写入，空间不足时按两倍扩展
+func (m *MMapRW) Write(buf []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	end := m.size + int64(len(buf))
+	if end > int64(len(m.data)) {
+		capacity := max(int64(len(m.data))*2, end, mmapGrowSize)
+		if err := m.fd.Truncate(capacity); err != nil {
+			return 0, err
+		}
+		if err := m.remap(capacity); err != nil {
+			return 0, err
+		}
+	}
+
+	copy(m.data[m.size:end], buf)
+	m.size = end
+	return len(buf), nil
+}
+
+// 将映射区域中修改的数据写回磁盘
+func (m *MMapRW) Sync() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.size == 0 {
+		return nil
+	}
+	return unix.Msync(m.data[:m.size], unix.MS_SYNC)
+}
+
+// 关闭文件，截掉预分配的空间
+func (m *MMapRW) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.unmap(); err != nil {
+		return err
+	}
+	if err := m.fd.Truncate(m.size); err != nil {
+		return err
+	}
+	return m.fd.Close()
+}
+
+func (m *MMapRW) Size() (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.size, nil
+}
+
+// 截断文件，同时释放预分配的空间
+func (m *MMapRW) Truncate(size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.unmap(); err != nil {
+		return err
+	}
+	if err := m.fd.Truncate(size); err != nil {
+		return err
+	}
+	m.size = size
+	return m.remap(size)
+}
+
+// 重新映射length大小的区域
+func (m *MMapRW) remap(length int64) error {
+	if err := m.unmap(); err != nil {
+		return err
+	}
+	if length == 0 {
+		return nil
+	}
+
+	data, err := unix.Mmap(int(m.fd.Fd()), 0, int(length), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	m.data = data
+	return nil
+}
+
+func (m *MMapRW) unmap() error {
+	if m.data == nil {
+		return nil
+	}
+	if err := unix.Munmap(m.data); err != nil {
+		return err
+	}
+	m.data = nil
+	return nil
+}
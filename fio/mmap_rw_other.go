@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fio
+
+import "errors"
+
+// 可读写的MMap依赖mmap和msync，仅支持unix平台
+func NewMMapRWIOManager(fileName string) (IOManager, error) {
+	return nil, errors.New("read-write mmap is only supported on unix")
+}
@@ -0,0 +1,87 @@
+//go:build unix
+
+package fio
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMMapRW_WriteRead(t *testing.T) {
+	path := filepath.Join("/tmp", "mmap-rw.data")
+	m, err := NewMMapRWIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+
+	_, err = m.Write([]byte("key-a"))
+	assert.Nil(t, err)
+	_, err = m.Write([]byte("key-b"))
+	assert.Nil(t, err)
+	size, err := m.Size()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), size)
+
+	b := make([]byte, 5)
+	n, err := m.Read(b, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, []byte("key-b"), b)
+
+	// 不能读到预分配的空间
+	n, err = m.Read(b, 8)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 2, n)
+
+	// 超出映射区域时重新映射
+	big := make([]byte, mmapGrowSize)
+	_, err = m.Write(big)
+	assert.Nil(t, err)
+	_, err = m.Write([]byte("key-c"))
+	assert.Nil(t, err)
+	n, err = m.Read(b, 10+mmapGrowSize)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-c"), b)
+	err = m.Sync()
+	assert.Nil(t, err)
+
+	// 关闭时截掉预分配的空间
+	err = m.Close()
+	assert.Nil(t, err)
+	stat, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(15+mmapGrowSize), stat.Size())
+
+	m, err = NewMMapRWIOManager(path)
+	assert.Nil(t, err)
+	n, err = m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("key-a"), b)
+	err = m.Close()
+	assert.Nil(t, err)
+}
+
+func TestMMapRW_Truncate(t *testing.T) {
+	path := filepath.Join("/tmp", "mmap-rw.data")
+	m, err := NewMMapRWIOManager(path)
+	defer destroyFile(path)
+	assert.Nil(t, err)
+
+	_, err = m.Write([]byte("bitcask kv"))
+	assert.Nil(t, err)
+	err = m.Truncate(7)
+	assert.Nil(t, err)
+	_, err = m.Write([]byte("-go"))
+	assert.Nil(t, err)
+
+	b := make([]byte, 10)
+	n, err := m.Read(b, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "bitcask-go", string(b[:n]))
+	err = m.Close()
+	assert.Nil(t, err)
+}
@@ -5,13 +5,16 @@ go 1.23.4
 require (
 	github.com/google/btree v1.1.3
 	github.com/stretchr/testify v1.10.0
+	github.com/zeebo/xxh3 v1.0.2
 )
 
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
+
 require (
 	github.com/tidwall/btree v1.7.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
-	github.com/tidwall/redcon v1.6.2 // indirect
-	golang.org/x/sys v0.29.0 // indirect
+	github.com/tidwall/redcon v1.6.2
+	golang.org/x/sys v0.29.0
 )
 
 require (
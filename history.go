@@ -0,0 +1,226 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"sort"
+	"time"
+)
+
+// key的一个版本
+type KeyVersion struct {
+	Version   uint64    // 写入该版本时分配的版本号
+	Timestamp time.Time // 写入时间，关闭历史版本模式时写入的数据为零值
+	Value     []byte
+	Deleted   bool // 该版本是否为删除操作
+}
+
+// 读取key在版本号seq时的值，即版本号不大于seq的最新版本
+// seq之前key不存在、已被删除或对应的版本已经被清理时返回ErrKeyNotFound
+func (db *DB) GetAt(key []byte, seq uint64) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if !db.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if pos := db.index.Get(key); pos != nil && pos.Version <= seq {
+		return db.getValueByPosition(pos)
+	}
+
+	entries := db.retainedHistory(key)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Version > seq {
+			continue
+		}
+		kv, err := db.readKeyVersion(entries[i])
+		if err != nil {
+			return nil, err
+		}
+		if kv.Deleted {
+			return nil, ErrKeyNotFound
+		}
+		return kv.Value, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+// 返回key所有保留的版本，按版本号从小到大排列，最后一个为当前版本
+func (db *DB) History(key []byte) ([]*KeyVersion, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if !db.historyEnabled() {
+		return nil, ErrHistoryDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	positions := db.retainedHistory(key)
+	if pos := db.index.Get(key); pos != nil {
+		positions = append(positions[:len(positions):len(positions)], pos)
+	}
+	if len(positions) == 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	versions := make([]*KeyVersion, 0, len(positions))
+	for _, pos := range positions {
+		kv, err := db.readKeyVersion(pos)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, kv)
+	}
+	return versions, nil
+}
+
+// 旧版本记录在数据文件中的位置
+type historyRef struct {
+	fid    uint32
+	offset int64
+}
+
+// 是否开启了历史版本模式
+func (db *DB) historyEnabled() bool {
+	return db.opt.HistoryVersions > 0 || db.opt.HistoryRetention > 0
+}
+
+// 记录key被覆盖或删除的旧版本，删除时还需要记录墓碑的位置
+// 访问此方法前必须持有互斥锁
+func (db *DB) addHistory(ns *Namespace, key []byte, positions ...*data.LogRecordPos) {
+	// 只有默认命名空间支持历史版本
+	if ns != nil || !db.historyEnabled() {
+		return
+	}
+
+	entries := db.history[string(key)]
+	for _, pos := range positions {
+		if pos == nil {
+			continue
+		}
+		// 按版本号有序插入，hint文件与数据文件的加载顺序不一定与版本号一致
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].Version > pos.Version
+		})
+		entries = append(entries, nil)
+		copy(entries[i+1:], entries[i:])
+		entries[i] = pos
+		db.addHistoryRef(key, pos)
+	}
+	db.trimHistory(key, entries)
+}
+
+// 清理超出保留范围的旧版本
+// 访问此方法前必须持有互斥锁
+func (db *DB) trimHistory(key []byte, entries []*data.LogRecordPos) {
+	start := db.historyStart(entries)
+	for _, pos := range entries[:start] {
+		db.removeHistoryRef(key, pos)
+	}
+	entries = entries[start:]
+	if len(entries) == 0 {
+		delete(db.history, string(key))
+		return
+	}
+	db.history[string(key)] = entries
+}
+
+// 清理所有key超出保留时间的旧版本，不再被写入的key也会被清理
+// 访问此方法前必须持有互斥锁
+func (db *DB) sweepHistory() {
+	if db.opt.HistoryRetention <= 0 {
+		return
+	}
+	for k, entries := range db.history {
+		db.trimHistory([]byte(k), entries)
+	}
+}
+
+func (db *DB) addHistoryRef(key []byte, pos *data.LogRecordPos) {
+	ref := historyRef{fid: pos.Fid, offset: pos.Offset}
+	keys := db.historyRefs[ref]
+	if keys == nil {
+		keys = make(map[string]bool)
+		db.historyRefs[ref] = keys
+	}
+	keys[string(key)] = true
+}
+
+func (db *DB) removeHistoryRef(key []byte, pos *data.LogRecordPos) {
+	ref := historyRef{fid: pos.Fid, offset: pos.Offset}
+	keys := db.historyRefs[ref]
+	delete(keys, string(key))
+	if len(keys) == 0 {
+		delete(db.historyRefs, ref)
+	}
+}
+
+// 获取key仍在保留范围内的旧版本
+// 访问此方法前必须持有读锁
+func (db *DB) retainedHistory(key []byte) []*data.LogRecordPos {
+	entries := db.history[string(key)]
+	return entries[db.historyStart(entries):]
+}
+
+// 计算保留范围的起点：最近的HistoryVersions个版本以及写入时间在HistoryRetention之内的版本都会被保留
+func (db *DB) historyStart(entries []*data.LogRecordPos) int {
+	start := len(entries)
+	if n := db.opt.HistoryVersions; n > 0 {
+		start = max(len(entries)-n, 0)
+	}
+	if d := db.opt.HistoryRetention; d > 0 {
+		deadline := time.Now().Add(-d).UnixNano()
+		for start > 0 && entries[start-1].Timestamp >= deadline {
+			start--
+		}
+	}
+	return start
+}
+
+// 判断位于fid和offset的记录是否为需要保留的历史版本，返回引用该记录的所有key
+// 区间删除墓碑可能被多个key引用，其余记录只可能被记录中的key引用
+// 访问此方法前必须持有读锁
+func (db *DB) historyKeysAt(lr *data.LogRecord, fid uint32, offset int64) [][]byte {
+	if !db.historyEnabled() || lr.Flags&data.LogRecordNamespaced != 0 {
+		return nil
+	}
+
+	var keys [][]byte
+	for k := range db.historyRefs[historyRef{fid: fid, offset: offset}] {
+		// 超出保留时间但还没有清理的版本不再保留
+		for _, pos := range db.retainedHistory([]byte(k)) {
+			if pos.Fid == fid && pos.Offset == offset {
+				keys = append(keys, []byte(k))
+				break
+			}
+		}
+	}
+	return keys
+}
+
+// 读取位置对应的版本信息
+func (db *DB) readKeyVersion(pos *data.LogRecordPos) (*KeyVersion, error) {
+	kv := &KeyVersion{Version: pos.Version}
+	if pos.Timestamp != 0 {
+		kv.Timestamp = time.Unix(0, pos.Timestamp)
+	}
+
+	logRecord, err := db.getLogRecordByPosition(pos)
+	switch {
+	case err == ErrKeyNotFound:
+		kv.Deleted = true
+	case err != nil:
+		return nil, err
+	case logRecord.Type == data.LogRecordRangeDeleted:
+		kv.Deleted = true
+	default:
+		kv.Value = logRecord.Value
+	}
+	return kv, nil
+}
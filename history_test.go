@@ -0,0 +1,199 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/utils"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_History(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-history-1")
+	opts.DirPath = dir
+	opts.HistoryVersions = 2
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 1.保留最近的2个旧版本
+	var versions []uint64
+	for i := 0; i < 4; i++ {
+		err := db.Put(utils.GetTestKey(1), []byte{byte('a' + i)})
+		assert.Nil(t, err)
+		_, version, err := db.GetWithVersion(utils.GetTestKey(1))
+		assert.Nil(t, err)
+		versions = append(versions, version)
+	}
+
+	history, err := db.History(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+	assert.Equal(t, []byte("b"), history[0].Value)
+	assert.Equal(t, versions[1], history[0].Version)
+	assert.Equal(t, []byte("d"), history[2].Value)
+	assert.False(t, history[2].Timestamp.IsZero())
+
+	// 2.按版本号读取
+	val, err := db.GetAt(utils.GetTestKey(1), versions[2])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+	val, err = db.GetAt(utils.GetTestKey(1), versions[3]+10)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), val)
+	_, err = db.GetAt(utils.GetTestKey(1), versions[0])
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 3.删除之后仍然可以读取删除之前的版本
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err = db.GetAt(utils.GetTestKey(1), versions[3])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), val)
+	history, err = db.History(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.True(t, history[1].Deleted)
+
+	// 4.区间删除
+	err = db.Put(utils.GetTestKey(2), []byte("a"))
+	assert.Nil(t, err)
+	_, version, err := db.GetWithVersion(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	err = db.DeleteRange(utils.GetTestKey(2), nil)
+	assert.Nil(t, err)
+	val, err = db.GetAt(utils.GetTestKey(2), version)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+	_, err = db.GetAt(utils.GetTestKey(2), version+1)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// 5.重启之后历史版本仍然存在
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	val, err = db2.GetAt(utils.GetTestKey(1), versions[3])
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), val)
+	_, err = db2.GetAt(utils.GetTestKey(1), versions[2])
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err = db2.GetAt(utils.GetTestKey(2), version)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+	db = db2
+
+	// 6.关闭历史版本模式
+	opts2 := DefaultOptions
+	dir2, _ := os.MkdirTemp("", "bitcask-go-history-4")
+	opts2.DirPath = dir2
+	db3, err := OpenDB(opts2)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	_, err = db3.GetAt(utils.GetTestKey(1), 1)
+	assert.Equal(t, ErrHistoryDisabled, err)
+}
+
+func TestDB_History_Merge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-history-2")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.HistoryVersions = 1
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		for j := 0; j < 3; j++ {
+			err := db.Put(utils.GetTestKey(i), []byte{byte('a' + j)})
+			assert.Nil(t, err)
+		}
+	}
+	err = db.Delete(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	err = db.DeleteRange(utils.GetTestKey(500), nil)
+	assert.Nil(t, err)
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// merge之后只保留最近的1个旧版本
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	db = db2
+	assert.Equal(t, 499, len(db2.ListKeys()))
+
+	history, err := db2.History(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, []byte("b"), history[0].Value)
+	assert.Equal(t, []byte("c"), history[1].Value)
+
+	history, err = db2.History(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.True(t, history[0].Deleted)
+
+	history, err = db2.History(utils.GetTestKey(600))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.True(t, history[0].Deleted)
+	_, err = db2.GetAt(utils.GetTestKey(600), history[0].Version-1)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_History_Retention(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-history-3")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	opts.HistoryRetention = 200 * time.Millisecond
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 3; i++ {
+		err := db.Put(utils.GetTestKey(1), []byte{byte('a' + i)})
+		assert.Nil(t, err)
+	}
+	history, err := db.History(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(history))
+
+	// 区间删除墓碑被多个key引用
+	for i := 10; i < 20; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("value"))
+		assert.Nil(t, err)
+	}
+	err = db.DeleteRange(utils.GetTestKey(10), utils.GetTestKey(20))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(db.history))
+	rangePos := db.history[string(utils.GetTestKey(10))][1]
+	keys := db.historyKeysAt(&data.LogRecord{Type: data.LogRecordRangeDeleted}, rangePos.Fid, rangePos.Offset)
+	assert.Equal(t, 10, len(keys))
+
+	// 超过保留时长之后只剩当前版本
+	time.Sleep(300 * time.Millisecond)
+	history, err = db.History(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(history))
+	assert.Equal(t, []byte("c"), history[0].Value)
+
+	// 之后不再写入的key在merge时清理
+	err = db.Merge()
+	assert.Nil(t, err)
+	assert.Empty(t, db.history)
+	assert.Empty(t, db.historyRefs)
+}
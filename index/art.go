@@ -3,7 +3,7 @@ package index
 import (
 	"bitcask/data"
 	"bytes"
-	"sort"
+	"errors"
 	"sync"
 
 	goart "github.com/plar/go-adaptive-radix-tree/v2"
@@ -64,93 +64,151 @@ func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
 		return nil
 	}
 
-	art.lock.RLock()
-	defer art.lock.RUnlock()
-
-	return newARTIterator(art.tree, reverse)
+	return newARTIterator(art, reverse)
 }
 
 func (art *AdaptiveRadixTree) Close() error {
 	return nil
 }
 
+// ART 索引迭代器，基于goart的迭代器按需遍历，不复制数据
+// goart不支持从指定的key开始遍历，树结构在遍历过程中被修改时，一次性复制剩余的key继续遍历，之后的修改不再可见
 type artIterator struct {
-	curIndex int     // 当前迭代位置
-	reverse  bool    // 是否反向遍历
-	values   []*Item // key+位置信息
+	art      *AdaptiveRadixTree
+	reverse  bool // 是否反向遍历
+	iter     goart.Iterator
+	snapshot []artItem // 并发修改之后复制的剩余数据，iter为nil时使用
+	currKey  []byte
+	currPos  *data.LogRecordPos
 }
 
-func newARTIterator(tree goart.Tree, reverse bool) *artIterator {
-	var idx int = 0
-	values := make([]*Item, tree.Size())
-
-	if reverse {
-		idx = tree.Size() - 1
-	}
-
-	saveValue := func(node goart.Node) bool {
-		item := &Item{
-			key: node.Key(),
-			pos: node.Value().(*data.LogRecordPos),
-		}
-
-		values[idx] = item
-
-		if reverse {
-			idx--
-		} else {
-			idx++
-		}
-		return true
-	}
-
-	tree.ForEach(saveValue)
+type artItem struct {
+	key []byte
+	pos *data.LogRecordPos
+}
 
-	return &artIterator{
-		curIndex: 0,
-		reverse:  reverse,
-		values:   values,
-	}
+func newARTIterator(art *AdaptiveRadixTree, reverse bool) *artIterator {
+	arti := &artIterator{art: art, reverse: reverse}
+	arti.Rewind()
+	return arti
 }
 
+// 重新返回迭代器起点（第一个数据）
 func (arti *artIterator) Rewind() {
-	arti.curIndex = 0
+	arti.reset()
+	arti.advance(nil, true)
 }
 
 // 查找第一个大于等于（或小于等于）目标的key，从此开始遍历
 func (arti *artIterator) Seek(key []byte) {
-	if arti.reverse {
-		arti.curIndex = sort.Search(len(arti.values), func(i int) bool {
-			return bytes.Compare(arti.values[i].key, key) <= 0
-		})
-	} else {
-		arti.curIndex = sort.Search(len(arti.values), func(i int) bool {
-			return bytes.Compare(arti.values[i].key, key) >= 0
-		})
-	}
+	arti.reset()
+	arti.advance(key, true)
 }
 
 // 跳转到下一个key
 func (arti *artIterator) Next() {
-	arti.curIndex++
+	if arti.currKey == nil {
+		return
+	}
+	arti.advance(nil, true)
 }
 
 // 是否遍历完所有key
 func (arti *artIterator) Valid() bool {
-	return arti.curIndex < len(arti.values)
+	return arti.currKey != nil
 }
 
 // 当前位置的key值
 func (arti *artIterator) Key() []byte {
-	return arti.values[arti.curIndex].key
+	return arti.currKey
 }
 
 // 当前位置的value值
 func (arti *artIterator) Value() *data.LogRecordPos {
-	return arti.values[arti.curIndex].pos
+	return arti.currPos
 }
 
 // 关闭迭代器，释放对应资源
 func (arti *artIterator) Close() {
-	arti.values = nil
+	arti.iter, arti.snapshot, arti.currKey, arti.currPos = nil, nil, nil, nil
+}
+
+func (arti *artIterator) reset() {
+	arti.art.lock.RLock()
+	defer arti.art.lock.RUnlock()
+	arti.iter, arti.snapshot = arti.newTreeIterator(), nil
+	arti.currKey, arti.currPos = nil, nil
+}
+
+func (arti *artIterator) newTreeIterator() goart.Iterator {
+	if arti.reverse {
+		return arti.art.tree.Iterator(goart.TraverseReverse)
+	}
+	return arti.art.tree.Iterator()
+}
+
+// 移动到下一个位于bound之后（inclusive表示包含bound本身）的key，bound为nil时直接移动到下一个key
+func (arti *artIterator) advance(bound []byte, inclusive bool) {
+	arti.art.lock.RLock()
+	defer arti.art.lock.RUnlock()
+
+	for {
+		if arti.iter == nil {
+			arti.nextFromSnapshot()
+			return
+		}
+
+		node, err := arti.iter.Next()
+		if errors.Is(err, goart.ErrConcurrentModification) {
+			// 树结构被并发修改，复制已经返回过的key之后的数据，不再反复从头遍历
+			if bound == nil && arti.currKey != nil {
+				bound, inclusive = arti.currKey, false
+			}
+			arti.takeSnapshot(bound, inclusive)
+			continue
+		}
+		if err != nil || node == nil {
+			arti.currKey, arti.currPos = nil, nil
+			return
+		}
+
+		if bound != nil && !arti.isAfter(node.Key(), bound, inclusive) {
+			continue
+		}
+		arti.currKey, arti.currPos = node.Key(), node.Value().(*data.LogRecordPos)
+		return
+	}
+}
+
+// 按遍历方向复制位于bound之后的所有数据，调用前必须持有读锁
+func (arti *artIterator) takeSnapshot(bound []byte, inclusive bool) {
+	arti.iter, arti.snapshot = nil, []artItem{}
+	options := goart.TraverseLeaf
+	if arti.reverse {
+		options |= goart.TraverseReverse
+	}
+	arti.art.tree.ForEach(func(node goart.Node) bool {
+		if bound == nil || arti.isAfter(node.Key(), bound, inclusive) {
+			arti.snapshot = append(arti.snapshot, artItem{key: node.Key(), pos: node.Value().(*data.LogRecordPos)})
+		}
+		return true
+	}, options)
+}
+
+func (arti *artIterator) nextFromSnapshot() {
+	if len(arti.snapshot) == 0 {
+		arti.currKey, arti.currPos = nil, nil
+		return
+	}
+	arti.currKey, arti.currPos = arti.snapshot[0].key, arti.snapshot[0].pos
+	arti.snapshot = arti.snapshot[1:]
+}
+
+// 按遍历方向判断key是否位于bound之后
+func (arti *artIterator) isAfter(key, bound []byte, inclusive bool) bool {
+	cmp := bytes.Compare(key, bound)
+	if arti.reverse {
+		cmp = -cmp
+	}
+	return cmp > 0 || (inclusive && cmp == 0)
 }
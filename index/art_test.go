@@ -2,6 +2,8 @@ package index
 
 import (
 	"bitcask/data"
+	"bitcask/utils"
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -73,3 +75,60 @@ func TestAdaptiveRadixTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter.Value())
 	}
 }
+
+func TestAdaptiveRadixTree_Iterator_Modify(t *testing.T) {
+	art := NewART()
+	for i := 0; i < 100; i++ {
+		art.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	iter := art.Iterator(false)
+	defer iter.Close()
+
+	iter.Seek(utils.GetTestKey(50))
+	assert.Equal(t, utils.GetTestKey(50), iter.Key())
+
+	// 遍历过程中修改树结构，迭代器继续从上一个key之后遍历
+	var keys [][]byte
+	for ; iter.Valid(); iter.Next() {
+		keys = append(keys, iter.Key())
+		if len(keys) == 10 {
+			art.Delete(utils.GetTestKey(70))
+			art.Put(utils.GetTestKey(200), &data.LogRecordPos{Fid: 1, Offset: 200})
+		}
+	}
+	assert.Equal(t, 50, len(keys))
+	assert.Equal(t, utils.GetTestKey(200), keys[len(keys)-1])
+
+	iter2 := art.Iterator(true)
+	defer iter2.Close()
+	iter2.Seek(utils.GetTestKey(70))
+	assert.Equal(t, utils.GetTestKey(69), iter2.Key())
+}
+
+func TestAdaptiveRadixTree_Iterator_ModifyEveryStep(t *testing.T) {
+	art := NewART()
+	for i := 0; i < 1000; i++ {
+		art.Put(utils.GetTestKey(i*2), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 每次移动之后都修改树结构，剩余的数据只复制一次，之后的修改不可见
+	for _, reverse := range []bool{false, true} {
+		iter := art.Iterator(reverse)
+		var keys [][]byte
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			keys = append(keys, iter.Key())
+			art.Put(utils.GetTestKey(len(keys)*2+1), &data.LogRecordPos{Fid: 1})
+			art.Delete(utils.GetTestKey(len(keys)*2 + 1))
+		}
+		iter.Close()
+		assert.Equal(t, 1000, len(keys))
+		for i := 1; i < len(keys); i++ {
+			cmp := bytes.Compare(keys[i-1], keys[i])
+			if reverse {
+				cmp = -cmp
+			}
+			assert.Equal(t, -1, cmp)
+		}
+	}
+}
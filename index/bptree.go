@@ -2,12 +2,14 @@ package index
 
 import (
 	"bitcask/data"
+	"bytes"
 	"path/filepath"
 
 	"go.etcd.io/bbolt"
 )
 
-const bptreeIndexFileName = "bptree-index"
+// B+树索引文件名
+const BPTreeIndexFileName = "bptree-index"
 
 var indexBucketName = []byte("bitcask-index")
 
@@ -21,7 +23,7 @@ func NewBPlusTree(dirPath string, syncWrites bool) *BPlusTree {
 	opt := bbolt.DefaultOptions
 	opt.NoSync = !syncWrites
 
-	bptree, err := bbolt.Open(filepath.Join(dirPath, bptreeIndexFileName), 0644, opt)
+	bptree, err := bbolt.Open(filepath.Join(dirPath, BPTreeIndexFileName), 0644, opt)
 	if err != nil {
 		panic("failed to open bptree")
 	}
@@ -107,6 +109,11 @@ func (bpt *BPlusTree) Close() error {
 	return bpt.tree.Close()
 }
 
+// 持久化索引文件，NoSync模式下提交的事务在此之后才落盘
+func (bpt *BPlusTree) Sync() error {
+	return bpt.tree.Sync()
+}
+
 type bptreeIterator struct {
 	tx        *bbolt.Tx
 	cursor    *bbolt.Cursor
@@ -142,6 +149,16 @@ func (bpti *bptreeIterator) Rewind() {
 // 查找第一个大于等于（或小于等于）目标的key，从此开始遍历
 func (bpti *bptreeIterator) Seek(key []byte) {
 	bpti.currKey, bpti.currValue = bpti.cursor.Seek(key)
+	if !bpti.reverse {
+		return
+	}
+
+	// bbolt的Seek总是定位到第一个大于等于key的位置，反向遍历时需要回退
+	if bpti.currKey == nil {
+		bpti.currKey, bpti.currValue = bpti.cursor.Last()
+	} else if !bytes.Equal(bpti.currKey, key) {
+		bpti.currKey, bpti.currValue = bpti.cursor.Prev()
+	}
 }
 
 // 跳转到下一个key
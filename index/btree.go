@@ -3,7 +3,6 @@ package index
 import (
 	"bitcask/data"
 	"bytes"
-	"sort"
 	"sync"
 
 	btree "github.com/google/btree"
@@ -64,66 +63,57 @@ func (bt *BTree) Iterator(reverse bool) Iterator {
 		return nil
 	}
 
-	bt.lock.RLock()
-	defer bt.lock.RUnlock()
+	// Clone会修改原树节点的写时复制标记，不能与写操作并发执行
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
 
-	return newBtreeIterator(bt.tree, reverse)
+	return newBtreeIterator(bt.tree.Clone(), reverse)
 }
 
 func (bt *BTree) Close() error {
 	return nil
 }
 
+// 迭代器每次从btree中取出的数据条数
+const btreeIteratorBatchSize = 128
+
 // BTree 索引迭代器
+// 在创建时克隆的btree快照上按批次遍历，只缓存当前批次的数据
 type btreeIterator struct {
-	curIndex int     // 当前迭代位置
-	reverse  bool    // 是否反向遍历
-	values   []*Item // key+位置信息
+	tree     *btree.BTree // 写时复制的btree快照，不受后续写操作影响
+	reverse  bool         // 是否反向遍历
+	curIndex int          // 当前批次中的迭代位置
+	values   []*Item      // 当前批次的key+位置信息
 }
 
 // 初始化btree迭代器
 func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
-	var idx int
-	values := make([]*Item, tree.Len())
-	saveValues := func(item btree.Item) bool {
-		values[idx] = item.(*Item)
-		idx++
-		return true
-	}
-	if reverse {
-		tree.Descend(saveValues)
-	} else {
-		tree.Ascend(saveValues)
-	}
-
-	return &btreeIterator{
-		curIndex: 0,
-		reverse:  reverse,
-		values:   values,
+	bti := &btreeIterator{
+		tree:    tree,
+		reverse: reverse,
+		values:  make([]*Item, 0, btreeIteratorBatchSize),
 	}
+	bti.Rewind()
+	return bti
 }
 
 // 重新返回迭代器起点（第一个数据）
 func (bti *btreeIterator) Rewind() {
-	bti.curIndex = 0
+	bti.fill(nil, true)
 }
 
 // 查找第一个大于等于（或小于等于）目标的key，从此开始遍历
 func (bti *btreeIterator) Seek(key []byte) {
-	if bti.reverse {
-		bti.curIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
-		})
-	} else {
-		bti.curIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
-		})
-	}
+	bti.fill(key, true)
 }
 
 // 跳转到下一个key
 func (bti *btreeIterator) Next() {
 	bti.curIndex++
+	// 当前批次遍历完毕，从最后一个key之后继续取数据
+	if bti.curIndex == len(bti.values) && len(bti.values) == btreeIteratorBatchSize {
+		bti.fill(bti.values[len(bti.values)-1].key, false)
+	}
 }
 
 // 是否遍历完所有key
@@ -143,5 +133,37 @@ func (bti *btreeIterator) Value() *data.LogRecordPos {
 
 // 关闭迭代器，释放对应资源
 func (bti *btreeIterator) Close() {
+	bti.tree = nil
 	bti.values = nil
 }
+
+// 从pivot开始取出下一批数据，pivot为nil时从头开始，inclusive表示是否包含pivot本身
+func (bti *btreeIterator) fill(pivot []byte, inclusive bool) {
+	if bti.tree == nil {
+		return
+	}
+
+	values := bti.values[:0]
+	saveValues := func(item btree.Item) bool {
+		it := item.(*Item)
+		if !inclusive && bytes.Equal(it.key, pivot) {
+			return true
+		}
+		values = append(values, it)
+		return len(values) < btreeIteratorBatchSize
+	}
+
+	switch {
+	case pivot == nil && bti.reverse:
+		bti.tree.Descend(saveValues)
+	case pivot == nil:
+		bti.tree.Ascend(saveValues)
+	case bti.reverse:
+		bti.tree.DescendLessOrEqual(&Item{key: pivot}, saveValues)
+	default:
+		bti.tree.AscendGreaterOrEqual(&Item{key: pivot}, saveValues)
+	}
+
+	bti.values = values
+	bti.curIndex = 0
+}
@@ -106,3 +106,44 @@ func TestBtree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter7.Key())
 	}
 }
+
+func TestBTree_Iterator_Batches(t *testing.T) {
+	bt := NewBTree()
+	n := btreeIteratorBatchSize*3 + 7
+	for i := 0; i < n; i++ {
+		bt.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	// 迭代器基于快照，不受创建之后的写操作影响
+	iter1 := bt.Iterator(false)
+	bt.Put(utils.GetTestKey(n), &data.LogRecordPos{Fid: 1, Offset: int64(n)})
+	bt.Delete(utils.GetTestKey(0))
+
+	var count int
+	for iter1.Rewind(); iter1.Valid(); iter1.Next() {
+		assert.Equal(t, utils.GetTestKey(count), iter1.Key())
+		assert.Equal(t, int64(count), iter1.Value().Offset)
+		count++
+	}
+	assert.Equal(t, n, count)
+	iter1.Close()
+
+	iter2 := bt.Iterator(true)
+	count = n
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.Equal(t, utils.GetTestKey(count), iter2.Key())
+		count--
+	}
+	assert.Equal(t, 0, count)
+	iter2.Close()
+
+	iter3 := bt.Iterator(false)
+	iter3.Seek(utils.GetTestKey(200))
+	count = 200
+	for ; iter3.Valid(); iter3.Next() {
+		assert.Equal(t, utils.GetTestKey(count), iter3.Key())
+		count++
+	}
+	assert.Equal(t, n+1, count)
+	iter3.Close()
+}
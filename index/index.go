@@ -23,6 +23,7 @@ const (
 	Btree IndexType = iota + 1
 	ART             // 自适应基数树
 	BPTree
+	SkipList // 无锁跳表
 )
 
 // 根据索引类型初始化内存索引
@@ -34,6 +35,8 @@ func NewIndexer(typ IndexType, dirPath string, sync bool) Indexer {
 		return NewART()
 	case BPTree:
 		return NewBPlusTree(dirPath, sync)
+	case SkipList:
+		return NewSkipList()
 	default:
 		panic("unsupported index type")
 	}
@@ -0,0 +1,363 @@
+package index
+
+import (
+	"bitcask/data"
+	"bytes"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	skipListMaxHeight = 20   // 跳表最大层数
+	skipListP         = 0.25 // 节点晋升到上一层的概率
+)
+
+// 无锁跳表索引
+// Get和迭代不加锁，Put/Delete通过CAS更新节点指针和位置信息
+// Delete先将位置信息置为nil，再从高到低逐层标记节点的后继指针，之后查找路径上的写操作会把已标记的节点摘除，
+// 被摘除的节点仍然指向原来的后继，停在该节点上的迭代器可以继续遍历，节点不再被引用之后由GC回收
+type ConcurrentSkipList struct {
+	head   *skipListNode
+	height atomic.Int32 // 当前最高层数
+	size   atomic.Int64 // 有效key的数量
+}
+
+type skipListNode struct {
+	key  []byte
+	pos  atomic.Pointer[data.LogRecordPos] // 为nil表示key已被删除，节点不会再被复用
+	next []atomic.Pointer[skipListLink]
+}
+
+// 节点在某一层的后继，创建后不再修改，通过替换整个对象实现对后继和删除标记的原子更新
+type skipListLink struct {
+	node   *skipListNode
+	marked bool // 所属节点已被删除，不能再在它之后插入
+}
+
+func newSkipListNode(key []byte, pos *data.LogRecordPos, height int) *skipListNode {
+	node := &skipListNode{
+		key:  key,
+		next: make([]atomic.Pointer[skipListLink], height),
+	}
+	for level := range node.next {
+		node.next[level].Store(&skipListLink{})
+	}
+	node.pos.Store(pos)
+	return node
+}
+
+// 初始化跳表索引
+func NewSkipList() *ConcurrentSkipList {
+	sl := &ConcurrentSkipList{head: newSkipListNode(nil, nil, skipListMaxHeight)}
+	sl.height.Store(1)
+	return sl
+}
+
+func (sl *ConcurrentSkipList) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
+	var prevs, nexts [skipListMaxHeight]*skipListNode
+
+	for {
+		sl.findSplice(key, &prevs, &nexts)
+
+		// key已经存在，直接替换位置信息；节点已被删除时帮助摘除后重新插入
+		if node := nexts[0]; node != nil && bytes.Equal(node.key, key) {
+			if oldPos, ok := node.swapPos(pos); ok {
+				return oldPos
+			}
+			sl.remove(node)
+			continue
+		}
+
+		height := sl.randomHeight()
+		node := newSkipListNode(key, pos, height)
+		for level := 0; level < height; level++ {
+			node.next[level].Store(&skipListLink{node: nexts[level]})
+		}
+
+		// 第0层链接成功即表示插入成功，失败则重新查找插入位置
+		if !casNext(prevs[0], 0, nexts[0], node) {
+			continue
+		}
+		sl.size.Add(1)
+
+		// 逐层向上链接
+		for level := 1; level < height; level++ {
+			for {
+				link := node.next[level].Load()
+				// 节点已被并发删除，不再链接更高的层
+				if link.marked {
+					sl.remove(node)
+					return nil
+				}
+				if link.node != nexts[level] && !node.next[level].CompareAndSwap(link, &skipListLink{node: nexts[level]}) {
+					continue
+				}
+				if casNext(prevs[level], level, nexts[level], node) {
+					break
+				}
+				// 该层有并发修改，重新查找插入位置
+				sl.findSplice(key, &prevs, &nexts)
+			}
+		}
+		// 链接过程中被删除的节点可能又被链接到了更高的层
+		if node.next[height-1].Load().marked {
+			sl.remove(node)
+		}
+		return nil
+	}
+}
+
+func (sl *ConcurrentSkipList) Get(key []byte) *data.LogRecordPos {
+	node := sl.findGreaterOrEqual(key)
+	if node == nil || !bytes.Equal(node.key, key) {
+		return nil
+	}
+	return node.pos.Load()
+}
+
+func (sl *ConcurrentSkipList) Delete(key []byte) (*data.LogRecordPos, bool) {
+	node := sl.findGreaterOrEqual(key)
+	if node == nil || !bytes.Equal(node.key, key) {
+		return nil, false
+	}
+
+	oldPos := node.pos.Swap(nil)
+	if oldPos == nil {
+		return nil, false
+	}
+	sl.size.Add(-1)
+	sl.remove(node)
+	return oldPos, true
+}
+
+func (sl *ConcurrentSkipList) Size() int {
+	return int(sl.size.Load())
+}
+
+func (sl *ConcurrentSkipList) Iterator(reverse bool) Iterator {
+	return newSkipListIterator(sl, reverse)
+}
+
+func (sl *ConcurrentSkipList) Close() error {
+	return nil
+}
+
+// 替换未删除节点的位置信息，节点已被删除时返回false
+func (node *skipListNode) swapPos(pos *data.LogRecordPos) (*data.LogRecordPos, bool) {
+	for {
+		oldPos := node.pos.Load()
+		if oldPos == nil {
+			return nil, false
+		}
+		if node.pos.CompareAndSwap(oldPos, pos) {
+			return oldPos, true
+		}
+	}
+}
+
+// 从高到低逐层标记已删除的节点，再沿查找路径摘除
+func (sl *ConcurrentSkipList) remove(node *skipListNode) {
+	for level := len(node.next) - 1; level >= 0; level-- {
+		for {
+			link := node.next[level].Load()
+			if link.marked || node.next[level].CompareAndSwap(link, &skipListLink{node: link.node, marked: true}) {
+				break
+			}
+		}
+	}
+	var prevs, nexts [skipListMaxHeight]*skipListNode
+	sl.findSplice(node.key, &prevs, &nexts)
+}
+
+// 前驱节点没有被删除且后继仍为next时，将后继替换为node
+func casNext(prev *skipListNode, level int, next, node *skipListNode) bool {
+	link := prev.next[level].Load()
+	if link.marked || link.node != next {
+		return false
+	}
+	return prev.next[level].CompareAndSwap(link, &skipListLink{node: node})
+}
+
+// 随机生成节点层数
+func (sl *ConcurrentSkipList) randomHeight() int {
+	height := 1
+	for height < skipListMaxHeight && rand.Float64() < skipListP {
+		height++
+	}
+
+	// 更新跳表当前最高层数
+	for {
+		cur := sl.height.Load()
+		if int32(height) <= cur || sl.height.CompareAndSwap(cur, int32(height)) {
+			break
+		}
+	}
+	return height
+}
+
+// 查找每一层中key的插入位置：prev.key < key <= next.key，并摘除路径上已标记删除的节点
+func (sl *ConcurrentSkipList) findSplice(key []byte, prevs, nexts *[skipListMaxHeight]*skipListNode) {
+	for {
+		prev, ok := sl.head, true
+		for level := skipListMaxHeight - 1; level >= 0 && ok; level-- {
+			prev, nexts[level], ok = sl.findSpliceForLevel(key, prev, level)
+			prevs[level] = prev
+		}
+		if ok {
+			return
+		}
+	}
+}
+
+// 前驱节点在查找过程中被删除时返回false，需要从头重新查找
+func (sl *ConcurrentSkipList) findSpliceForLevel(key []byte, before *skipListNode, level int) (*skipListNode, *skipListNode, bool) {
+	for {
+		link := before.next[level].Load()
+		if link.marked {
+			return nil, nil, false
+		}
+		next := link.node
+		if next == nil {
+			return before, nil, true
+		}
+		if nextLink := next.next[level].Load(); nextLink.marked {
+			// 摘除已标记删除的后继节点
+			before.next[level].CompareAndSwap(link, &skipListLink{node: nextLink.node})
+			continue
+		}
+		if bytes.Compare(next.key, key) >= 0 {
+			return before, next, true
+		}
+		before = next
+	}
+}
+
+// 查找第一个key大于等于目标的节点（可能是已删除的节点）
+func (sl *ConcurrentSkipList) findGreaterOrEqual(key []byte) *skipListNode {
+	prev := sl.head
+	var next *skipListNode
+	for level := int(sl.height.Load()) - 1; level >= 0; level-- {
+		for next = prev.next[level].Load().node; next != nil && bytes.Compare(next.key, key) < 0; next = prev.next[level].Load().node {
+			prev = next
+		}
+	}
+	return next
+}
+
+// 查找最后一个key小于目标的节点（可能是已删除的节点）
+func (sl *ConcurrentSkipList) findLessThan(key []byte) *skipListNode {
+	prev := sl.head
+	for level := int(sl.height.Load()) - 1; level >= 0; level-- {
+		for next := prev.next[level].Load().node; next != nil && bytes.Compare(next.key, key) < 0; next = prev.next[level].Load().node {
+			prev = next
+		}
+	}
+	if prev == sl.head {
+		return nil
+	}
+	return prev
+}
+
+// 查找最后一个节点（可能是已删除的节点）
+func (sl *ConcurrentSkipList) findLast() *skipListNode {
+	prev := sl.head
+	for level := int(sl.height.Load()) - 1; level >= 0; level-- {
+		for next := prev.next[level].Load().node; next != nil; next = prev.next[level].Load().node {
+			prev = next
+		}
+	}
+	if prev == sl.head {
+		return nil
+	}
+	return prev
+}
+
+// 跳表索引迭代器，直接在跳表上遍历，不复制数据
+type skipListIterator struct {
+	sl      *ConcurrentSkipList
+	reverse bool
+	curr    *skipListNode
+	currPos *data.LogRecordPos // 定位到节点时读取的位置信息
+}
+
+func newSkipListIterator(sl *ConcurrentSkipList, reverse bool) *skipListIterator {
+	sli := &skipListIterator{sl: sl, reverse: reverse}
+	sli.Rewind()
+	return sli
+}
+
+// 重新返回迭代器起点（第一个数据）
+func (sli *skipListIterator) Rewind() {
+	if sli.reverse {
+		sli.curr = sli.sl.findLast()
+	} else {
+		sli.curr = sli.sl.head.next[0].Load().node
+	}
+	sli.skipDeleted()
+}
+
+// 查找第一个大于等于（或小于等于）目标的key，从此开始遍历
+func (sli *skipListIterator) Seek(key []byte) {
+	node := sli.sl.findGreaterOrEqual(key)
+	if sli.reverse && (node == nil || !bytes.Equal(node.key, key)) {
+		node = sli.sl.findLessThan(key)
+	}
+	sli.curr = node
+	sli.skipDeleted()
+}
+
+// 跳转到下一个key
+func (sli *skipListIterator) Next() {
+	sli.step()
+	sli.skipDeleted()
+}
+
+// 是否遍历完所有key
+func (sli *skipListIterator) Valid() bool {
+	return sli.curr != nil
+}
+
+// 当前位置的key值
+func (sli *skipListIterator) Key() []byte {
+	return sli.curr.key
+}
+
+// 当前位置的value值
+func (sli *skipListIterator) Value() *data.LogRecordPos {
+	return sli.currPos
+}
+
+// 关闭迭代器，释放对应资源
+func (sli *skipListIterator) Close() {
+	sli.curr, sli.currPos = nil, nil
+}
+
+func (sli *skipListIterator) step() {
+	if sli.curr == nil {
+		return
+	}
+	if sli.reverse {
+		sli.curr = sli.sl.findLessThan(sli.curr.key)
+		return
+	}
+	// 当前节点已被摘除时后继不再更新，重新查找之后的节点
+	link := sli.curr.next[0].Load()
+	if !link.marked {
+		sli.curr = link.node
+		return
+	}
+	key := sli.curr.key
+	for sli.curr = sli.sl.findGreaterOrEqual(key); sli.curr != nil && bytes.Equal(sli.curr.key, key); {
+		sli.curr = sli.curr.next[0].Load().node
+	}
+}
+
+// 跳过已删除的节点
+func (sli *skipListIterator) skipDeleted() {
+	for ; sli.curr != nil; sli.step() {
+		if sli.currPos = sli.curr.pos.Load(); sli.currPos != nil {
+			return
+		}
+	}
+	sli.currPos = nil
+}
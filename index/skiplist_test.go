@@ -0,0 +1,248 @@
+package index
+
+import (
+	"bitcask/data"
+	"bitcask/utils"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipList_Put(t *testing.T) {
+	sl := NewSkipList()
+	res1 := sl.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 100})
+	assert.Nil(t, res1)
+	res2 := sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	assert.Nil(t, res2)
+	res3 := sl.Put([]byte("a"), &data.LogRecordPos{Fid: 2, Offset: 3})
+	assert.Equal(t, res3.Fid, uint32(1))
+	assert.Equal(t, res3.Offset, int64(2))
+}
+
+func TestSkipList_Get(t *testing.T) {
+	sl := NewSkipList()
+	pos := sl.Get([]byte("not exist"))
+	assert.Nil(t, pos)
+
+	sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	sl.Put([]byte("a"), &data.LogRecordPos{Fid: 1, Offset: 3})
+	pos1 := sl.Get([]byte("a"))
+	assert.Equal(t, uint32(1), pos1.Fid)
+	assert.Equal(t, int64(3), pos1.Offset)
+}
+
+func TestSkipList_Delete(t *testing.T) {
+	sl := NewSkipList()
+
+	res1, ok1 := sl.Delete([]byte("not exist"))
+	assert.False(t, ok1)
+	assert.Nil(t, res1)
+
+	sl.Put([]byte("aaa"), &data.LogRecordPos{Fid: 22, Offset: 33})
+	res2, ok2 := sl.Delete([]byte("aaa"))
+	assert.True(t, ok2)
+	assert.Equal(t, uint32(22), res2.Fid)
+	assert.Equal(t, int64(33), res2.Offset)
+	assert.Nil(t, sl.Get([]byte("aaa")))
+
+	// 重复删除
+	res3, ok3 := sl.Delete([]byte("aaa"))
+	assert.False(t, ok3)
+	assert.Nil(t, res3)
+
+	// 删除后重新写入
+	res4 := sl.Put([]byte("aaa"), &data.LogRecordPos{Fid: 1, Offset: 1})
+	assert.Nil(t, res4)
+	assert.Equal(t, 1, sl.Size())
+}
+
+func TestSkipList_Size(t *testing.T) {
+	sl := NewSkipList()
+	assert.Equal(t, 0, sl.Size())
+
+	sl.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	sl.Put([]byte("key-2"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	sl.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 12})
+	assert.Equal(t, 2, sl.Size())
+
+	sl.Delete([]byte("key-2"))
+	assert.Equal(t, 1, sl.Size())
+}
+
+func TestSkipList_Iterator(t *testing.T) {
+	sl := NewSkipList()
+
+	// 跳表为空的情况
+	iter1 := sl.Iterator(false)
+	assert.False(t, iter1.Valid())
+
+	for i := 0; i < 10; i++ {
+		sl.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	sl.Delete(utils.GetTestKey(0))
+	sl.Delete(utils.GetTestKey(5))
+	sl.Delete(utils.GetTestKey(9))
+
+	// 正向遍历，跳过已删除的key
+	var keys [][]byte
+	iter2 := sl.Iterator(false)
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		keys = append(keys, iter2.Key())
+	}
+	assert.Equal(t, [][]byte{
+		utils.GetTestKey(1), utils.GetTestKey(2), utils.GetTestKey(3), utils.GetTestKey(4),
+		utils.GetTestKey(6), utils.GetTestKey(7), utils.GetTestKey(8),
+	}, keys)
+
+	// 反向遍历
+	iter3 := sl.Iterator(true)
+	iter3.Rewind()
+	assert.Equal(t, utils.GetTestKey(8), iter3.Key())
+	assert.Equal(t, int64(8), iter3.Value().Offset)
+
+	// Seek
+	iter4 := sl.Iterator(false)
+	iter4.Seek(utils.GetTestKey(5))
+	assert.Equal(t, utils.GetTestKey(6), iter4.Key())
+	iter5 := sl.Iterator(true)
+	iter5.Seek(utils.GetTestKey(5))
+	assert.Equal(t, utils.GetTestKey(4), iter5.Key())
+	iter5.Seek(utils.GetTestKey(100))
+	assert.Equal(t, utils.GetTestKey(8), iter5.Key())
+}
+
+func TestSkipList_Concurrent(t *testing.T) {
+	sl := NewSkipList()
+
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g; i < 8000; i += 8 {
+				sl.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+			}
+		}(g)
+	}
+
+	// 写入的同时进行迭代
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		iter := sl.Iterator(false)
+		var prev []byte
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			if prev != nil {
+				assert.True(t, string(prev) < string(iter.Key()))
+			}
+			prev = iter.Key()
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 8000, sl.Size())
+	for i := 0; i < 8000; i++ {
+		pos := sl.Get(utils.GetTestKey(i))
+		assert.NotNil(t, pos)
+		assert.Equal(t, int64(i), pos.Offset)
+	}
+}
+
+// 统计第0层上仍然链接的节点数量
+func skipListLinkedCount(sl *ConcurrentSkipList) int {
+	count := 0
+	for node := sl.head.next[0].Load().node; node != nil; node = node.next[0].Load().node {
+		count++
+	}
+	return count
+}
+
+func TestSkipList_DeleteUnlink(t *testing.T) {
+	sl := NewSkipList()
+	for i := 0; i < 1000; i++ {
+		sl.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	assert.Equal(t, 1000, skipListLinkedCount(sl))
+
+	// 删除的节点从所有层摘除
+	for i := 0; i < 1000; i += 2 {
+		_, ok := sl.Delete(utils.GetTestKey(i))
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 500, sl.Size())
+	assert.Equal(t, 500, skipListLinkedCount(sl))
+	for level := 1; level < skipListMaxHeight; level++ {
+		for node := sl.head.next[level].Load().node; node != nil; node = node.next[level].Load().node {
+			assert.NotNil(t, node.pos.Load())
+		}
+	}
+
+	// 删除后重新写入同一个key
+	sl.Put(utils.GetTestKey(0), &data.LogRecordPos{Fid: 2, Offset: 0})
+	assert.Equal(t, uint32(2), sl.Get(utils.GetTestKey(0)).Fid)
+	assert.Equal(t, 501, skipListLinkedCount(sl))
+
+	// 迭代器停在被删除的节点上时可以继续遍历
+	iter := sl.Iterator(false)
+	iter.Seek(utils.GetTestKey(1))
+	assert.Equal(t, utils.GetTestKey(1), iter.Key())
+	sl.Delete(utils.GetTestKey(1))
+	sl.Delete(utils.GetTestKey(3))
+	sl.Put(utils.GetTestKey(2), &data.LogRecordPos{Fid: 2, Offset: 2})
+	iter.Next()
+	assert.Equal(t, utils.GetTestKey(2), iter.Key())
+	iter.Next()
+	assert.Equal(t, utils.GetTestKey(5), iter.Key())
+}
+
+func TestSkipList_ConcurrentDelete(t *testing.T) {
+	sl := NewSkipList()
+
+	wg := new(sync.WaitGroup)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			// 同一批key反复写入和删除，最后一轮只写入偶数key
+			for round := 0; round < 5; round++ {
+				for i := g; i < 2000; i += 8 {
+					sl.Put(utils.GetTestKey(i), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+				}
+				for i := g; i < 2000; i += 8 {
+					if round < 4 || i%2 == 1 {
+						sl.Delete(utils.GetTestKey(i))
+					}
+				}
+			}
+		}(g)
+	}
+
+	// 写入和删除的同时进行迭代
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for round := 0; round < 20; round++ {
+			iter := sl.Iterator(round%2 == 1)
+			var prev []byte
+			for iter.Rewind(); iter.Valid(); iter.Next() {
+				if prev != nil {
+					assert.NotEqual(t, string(prev), string(iter.Key()))
+				}
+				prev = iter.Key()
+			}
+		}
+	}()
+	wg.Wait()
+
+	assert.Equal(t, 1000, sl.Size())
+	assert.Equal(t, 1000, skipListLinkedCount(sl))
+	for i := 0; i < 2000; i++ {
+		pos := sl.Get(utils.GetTestKey(i))
+		if i%2 == 0 {
+			assert.NotNil(t, pos)
+		} else {
+			assert.Nil(t, pos)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package bitcask
+
+import (
+	"bitcask/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_InMemory(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-inmemory"
+	opts.DataFileSize = 64 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.InMemory = true
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 500; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > 0)
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.BackUp("/bitcask-go-inmemory-backup")
+	assert.Nil(t, err)
+	err = db.Checkpoint("/bitcask-go-inmemory-checkpoint")
+	assert.Nil(t, err)
+	err = db.IncrementalBackUp("/bitcask-go-inmemory-incremental")
+	assert.Nil(t, err)
+	err = RestoreFS(db.opt.FS, "/bitcask-go-inmemory-incremental", "/bitcask-go-inmemory-restore", 0)
+	assert.Nil(t, err)
+
+	// 没有访问磁盘
+	for _, dir := range []string{opts.DirPath, opts.DirPath + mergeDirName, "/bitcask-go-inmemory-backup", "/bitcask-go-inmemory-checkpoint"} {
+		_, err = os.Stat(dir)
+		assert.True(t, os.IsNotExist(err))
+	}
+
+	// 同一个内存文件系统上的数据目录只能被打开一次
+	opts.FS = db.opt.FS
+	_, err = OpenDB(opts)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+
+	// 重新打开时应用merge的结果
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 500, len(db.ListKeys()))
+	_, err = db.opt.FS.Stat(opts.DirPath + mergeDirName)
+	assert.True(t, os.IsNotExist(err))
+
+	for _, dir := range []string{"/bitcask-go-inmemory-backup", "/bitcask-go-inmemory-checkpoint", "/bitcask-go-inmemory-restore"} {
+		copyOpts := opts
+		copyOpts.DirPath = dir
+		copyDB, err := OpenDB(copyOpts)
+		assert.Nil(t, err)
+		assert.Equal(t, 500, len(copyDB.ListKeys()))
+		_, err = copyDB.Get(utils.GetTestKey(0))
+		assert.Equal(t, ErrKeyNotFound, err)
+		_, err = copyDB.Get(utils.GetTestKey(999))
+		assert.Nil(t, err)
+		destroyDB(copyDB)
+	}
+
+	// 不指定文件系统时每次打开都是新的内存文件系统
+	opts.FS = nil
+	db2, err := OpenDB(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(db2.ListKeys()))
+
+	// B+树索引文件保存在磁盘上
+	opts.IndexType = BPlusTree
+	_, err = OpenDB(opts)
+	assert.NotNil(t, err)
+}
+
+func TestDB_InMemory_MergeTwice(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-inmemory-merge"
+	opts.DataFileSize = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.InMemory = true
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 每次merge之后临时实例的文件锁都被释放
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 200; i++ {
+			err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+			assert.Nil(t, err)
+		}
+		err = db.Merge()
+		assert.Nil(t, err, "merge %d", round)
+	}
+
+	// 删除merge目录之后同一路径的锁可以重新获取
+	err = db.opt.FS.RemoveAll(db.getMergePath())
+	assert.Nil(t, err)
+	hold, err := db.opt.FS.NewLock(filepath.Join(db.getMergePath(), fileLockName)).TryLock()
+	assert.Nil(t, err)
+	assert.True(t, hold)
+}
@@ -10,39 +10,96 @@ type Iterator struct {
 	indexIterator index.Iterator // 索引迭代器，方便取出key和索引信息
 	db            *DB            // 根据索引信息取出value
 	options       IteratorOptions
+	lowerBound    []byte // 实际生效的下界（包含），由LowerBound和Prefix共同决定
+	upperBound    []byte // 实际生效的上界（不包含），由UpperBound和Prefix共同决定
+	count         int    // 已经遍历过的key数量
+	exhausted     bool   // 是否已经越过边界或达到数量上限
 }
 
 // 初始化数据库迭代器
 func (db *DB) NewIterator(opt IteratorOptions) *Iterator {
-	indexIter := db.index.Iterator(opt.Reverse)
-	return &Iterator{
+	return db.newIterator(db.index, opt)
+}
+
+func (db *DB) newIterator(idx index.Indexer, opt IteratorOptions) *Iterator {
+	indexIter := idx.Iterator(opt.Reverse)
+	it := &Iterator{
 		indexIterator: indexIter,
 		db:            db,
 		options:       opt,
+		lowerBound:    opt.LowerBound,
+		upperBound:    opt.UpperBound,
 	}
+
+	// 前缀等价于区间 [prefix, prefix的后继)
+	if len(opt.Prefix) > 0 {
+		if it.lowerBound == nil || bytes.Compare(opt.Prefix, it.lowerBound) > 0 {
+			it.lowerBound = opt.Prefix
+		}
+		if end := prefixSuccessor(opt.Prefix); end != nil {
+			if it.upperBound == nil || bytes.Compare(end, it.upperBound) < 0 {
+				it.upperBound = end
+			}
+		}
+	}
+
+	it.Rewind()
+	return it
 }
 
 // 重新返回迭代器起点（第一个数据）
 func (it *Iterator) Rewind() {
-	it.indexIterator.Rewind()
-	it.skipToNext()
+	it.count = 0
+	it.exhausted = false
+
+	// 直接定位到区间的起点
+	switch {
+	case !it.options.Reverse && it.lowerBound != nil:
+		it.indexIterator.Seek(it.lowerBound)
+	case it.options.Reverse && it.upperBound != nil:
+		it.seekBeforeUpperBound()
+	default:
+		it.indexIterator.Rewind()
+	}
+	it.checkBounds()
 }
 
 // 查找第一个大于等于（或小于等于）目标的key，从此开始遍历
 func (it *Iterator) Seek(key []byte) {
-	it.indexIterator.Seek(key)
-	it.skipToNext()
+	it.count = 0
+	it.exhausted = false
+
+	// 目标位于区间之外时，从区间的起点开始
+	switch {
+	case !it.options.Reverse && it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0:
+		it.indexIterator.Seek(it.lowerBound)
+	case it.options.Reverse && it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0:
+		it.seekBeforeUpperBound()
+	default:
+		it.indexIterator.Seek(key)
+	}
+	it.checkBounds()
 }
 
 // 跳转到下一个key
 func (it *Iterator) Next() {
+	if it.exhausted {
+		return
+	}
+
+	it.count++
+	if it.options.Limit > 0 && it.count >= it.options.Limit {
+		it.exhausted = true
+		return
+	}
+
 	it.indexIterator.Next()
-	it.skipToNext()
+	it.checkBounds()
 }
 
 // 是否遍历完所有key
 func (it *Iterator) Valid() bool {
-	return it.indexIterator.Valid()
+	return !it.exhausted && it.indexIterator.Valid()
 }
 
 // 当前位置的key值
@@ -52,6 +109,10 @@ func (it *Iterator) Key() []byte {
 
 // 当前位置的value值
 func (it *Iterator) Value() ([]byte, error) {
+	if it.options.KeysOnly {
+		return nil, ErrIteratorKeysOnly
+	}
+
 	logRecordPos := it.indexIterator.Value()
 	it.db.mu.RLock()
 	defer it.db.mu.RUnlock()
@@ -63,17 +124,37 @@ func (it *Iterator) Close() {
 	it.indexIterator.Close()
 }
 
-// 根据前缀要求过滤
-func (it *Iterator) skipToNext() {
-	prefixLen := len(it.options.Prefix)
-	if prefixLen == 0 {
+// 反向遍历时定位到第一个小于上界的key
+func (it *Iterator) seekBeforeUpperBound() {
+	it.indexIterator.Seek(it.upperBound)
+	if it.indexIterator.Valid() && bytes.Equal(it.indexIterator.Key(), it.upperBound) {
+		it.indexIterator.Next()
+	}
+}
+
+// 索引有序，当前key越过区间边界时直接结束遍历
+func (it *Iterator) checkBounds() {
+	if !it.indexIterator.Valid() {
 		return
 	}
 
-	for ; it.Valid(); it.Next() {
-		key := it.Key()
-		if prefixLen <= len(key) && bytes.Compare(it.options.Prefix, key[:prefixLen]) == 0 {
-			break
+	key := it.indexIterator.Key()
+	if it.options.Reverse {
+		it.exhausted = it.lowerBound != nil && bytes.Compare(key, it.lowerBound) < 0
+	} else {
+		it.exhausted = it.upperBound != nil && bytes.Compare(key, it.upperBound) >= 0
+	}
+}
+
+// 返回大于所有以prefix为前缀的key的最小key，prefix全为0xff时返回nil
+func prefixSuccessor(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
 		}
 	}
+	return nil
 }
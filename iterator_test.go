@@ -97,3 +97,69 @@ func TestDB_Iterator_Multi_Values(t *testing.T) {
 	}
 	iter3.Close()
 }
+
+func TestDB_Iterator_Bounds(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-4")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for _, key := range []string{"a", "ab", "abc", "abd", "ac", "b", "ba", "c"} {
+		err := db.Put([]byte(key), []byte(key))
+		assert.Nil(t, err)
+	}
+
+	collect := func(opt IteratorOptions) []string {
+		iter := db.NewIterator(opt)
+		defer iter.Close()
+		var keys []string
+		for ; iter.Valid(); iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		return keys
+	}
+
+	// 区间 [ab, b)
+	iterOpts1 := DefaultIteratorOptions
+	iterOpts1.LowerBound = []byte("ab")
+	iterOpts1.UpperBound = []byte("b")
+	assert.Equal(t, []string{"ab", "abc", "abd", "ac"}, collect(iterOpts1))
+
+	iterOpts1.Reverse = true
+	assert.Equal(t, []string{"ac", "abd", "abc", "ab"}, collect(iterOpts1))
+
+	// 前缀与区间同时生效
+	iterOpts2 := DefaultIteratorOptions
+	iterOpts2.Prefix = []byte("ab")
+	iterOpts2.LowerBound = []byte("abc")
+	assert.Equal(t, []string{"abc", "abd"}, collect(iterOpts2))
+
+	iterOpts2.Reverse = true
+	iterOpts2.LowerBound = nil
+	assert.Equal(t, []string{"abd", "abc", "ab"}, collect(iterOpts2))
+
+	// 限制数量
+	iterOpts3 := DefaultIteratorOptions
+	iterOpts3.Limit = 3
+	assert.Equal(t, []string{"a", "ab", "abc"}, collect(iterOpts3))
+
+	// Seek 到区间之外
+	iter := db.NewIterator(iterOpts1)
+	iter.Seek([]byte("z"))
+	assert.Equal(t, []byte("ac"), iter.Key())
+	iter.Seek([]byte("a"))
+	assert.False(t, iter.Valid())
+	iter.Close()
+
+	// 只遍历 key
+	iterOpts4 := DefaultIteratorOptions
+	iterOpts4.KeysOnly = true
+	iter4 := db.NewIterator(iterOpts4)
+	assert.Equal(t, []byte("a"), iter4.Key())
+	_, err = iter4.Value()
+	assert.Equal(t, ErrIteratorKeysOnly, err)
+	iter4.Close()
+}
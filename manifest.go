@@ -0,0 +1,177 @@
+package bitcask
+
+import (
+	"bitcask/fio"
+	"bitcask/index"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	manifestFileName = "MANIFEST"
+	manifestVersion  = 1
+
+	// 数据文件中的记录不做压缩
+	manifestCodecNone = "none"
+)
+
+// 数据目录的元数据，每次打开、切换活跃文件、merge和关闭时整体重写
+type manifest struct {
+	Version      int      `json:"version"`        // 元数据格式版本
+	IndexType    string   `json:"index_type"`     // 创建或最近一次迁移时的索引类型
+	DataFileSize int64    `json:"data_file_size"` // 最近一次打开时的数据文件大小，只做记录
+	Codec        string   `json:"codec"`          // 记录的压缩方式
+	Files        []uint32 `json:"files"`          // 有效的数据文件ID，升序排列
+	LastMerge    int64    `json:"last_merge"`     // 最近一次应用merge的时间，0表示没有merge过
+	SeqNo        uint64   `json:"seq_no"`         // 写入元数据时的序列号
+}
+
+var indexTypeNames = map[IndexerType]string{
+	Btree:     "btree",
+	ART:       "art",
+	BPlusTree: "bptree",
+	SkipList:  "skiplist",
+}
+
+// 根据当前状态生成元数据，fileIds为有效的数据文件ID
+func (db *DB) newManifest(fileIds []uint32) *manifest {
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+	return &manifest{
+		Version:      manifestVersion,
+		IndexType:    indexTypeNames[db.opt.IndexType],
+		DataFileSize: db.opt.DataFileSize,
+		Codec:        manifestCodecNone,
+		Files:        fileIds,
+		LastMerge:    db.lastMerge,
+		SeqNo:        db.seqNo,
+	}
+}
+
+// 以当前打开的数据文件重写元数据
+func (db *DB) saveManifest() error {
+	return writeManifest(db.opt.FS, db.opt.DirPath, db.newManifest(db.liveFileIds()))
+}
+
+// 当前打开的所有数据文件ID
+func (db *DB) liveFileIds() []uint32 {
+	fileIds := make([]uint32, 0, len(db.olderFiles)+1)
+	for fid := range db.olderFiles {
+		fileIds = append(fileIds, fid)
+	}
+	if db.activeFile != nil {
+		fileIds = append(fileIds, db.activeFile.FileID)
+	}
+	return fileIds
+}
+
+// 检查目录的元数据与配置是否兼容，没有元数据时返回nil
+func checkManifest(opt Options) (*manifest, error) {
+	m, err := readManifest(opt.FS, opt.DirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		// 旧版本的目录没有元数据，B+树索引文件不存在时无法得到数据
+		if opt.IndexType == BPlusTree {
+			if _, err := opt.FS.Stat(filepath.Join(opt.DirPath, index.BPTreeIndexFileName)); os.IsNotExist(err) {
+				fileIds, err := listDataFileIds(opt.FS, opt.DirPath)
+				if err != nil {
+					return nil, err
+				}
+				if len(fileIds) > 0 {
+					return nil, ErrIndexTypeMismatch
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	if m.Version > manifestVersion || m.Codec != manifestCodecNone {
+		return nil, ErrManifestIncompatible
+	}
+	if m.IndexType != indexTypeNames[opt.IndexType] {
+		return nil, ErrIndexTypeMismatch
+	}
+	return m, nil
+}
+
+// 检查目录中的数据文件与元数据记录的是否一致
+// 切换活跃文件时先写元数据再创建文件，最后一个文件可能还没有创建
+func checkManifestFiles(m *manifest, fileIds []int) error {
+	recorded := make(map[uint32]bool, len(m.Files))
+	for _, fid := range m.Files {
+		recorded[fid] = true
+	}
+
+	for _, fid := range fileIds {
+		if !recorded[uint32(fid)] {
+			return ErrManifestMismatch
+		}
+		delete(recorded, uint32(fid))
+	}
+
+	for fid := range recorded {
+		if len(recorded) > 1 || fid != m.Files[len(m.Files)-1] ||
+			(len(fileIds) > 0 && fid < uint32(fileIds[len(fileIds)-1])) {
+			return ErrManifestMismatch
+		}
+	}
+	return nil
+}
+
+// 读取数据目录中记录的索引类型，目录中没有元数据时返回false
+func ReadIndexType(opt Options) (IndexerType, bool, error) {
+	m, err := readManifest(opt.fileSystem(), opt.DirPath)
+	if err != nil || m == nil {
+		return 0, false, err
+	}
+	for typ, name := range indexTypeNames {
+		if name == m.IndexType {
+			return typ, true, nil
+		}
+	}
+	return 0, false, ErrManifestIncompatible
+}
+
+func readManifest(fsys fio.FS, dirPath string) (*manifest, error) {
+	buf, err := fsys.ReadFile(filepath.Join(dirPath, manifestFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &manifest{}
+	if err := json.Unmarshal(buf, m); err != nil {
+		return nil, ErrDataDirectoryCorrupted
+	}
+	return m, nil
+}
+
+// 先写临时文件并持久化，再重命名，保证元数据的原子性
+func writeManifest(fsys fio.FS, dirPath string, m *manifest) error {
+	buf, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(dirPath, manifestFileName+".tmp")
+	if err := fsys.WriteFile(tmpPath, buf); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmpPath, filepath.Join(dirPath, manifestFileName)); err != nil {
+		return err
+	}
+	return fsys.SyncDir(dirPath)
+}
+
+// 应用merge之后记录新的数据文件列表
+func (db *DB) saveMergedManifest(fileIds []uint32) error {
+	db.lastMerge = time.Now().UnixNano()
+	return writeManifest(db.opt.FS, db.opt.DirPath, db.newManifest(fileIds))
+}
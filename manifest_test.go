@@ -0,0 +1,117 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"bitcask/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Manifest(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-manifest-1")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	// 切换活跃文件时记录新的数据文件
+	m, err := readManifest(fio.OSFS{}, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "btree", m.IndexType)
+	assert.Equal(t, len(db.olderFiles)+1, len(m.Files))
+	assert.Equal(t, int64(0), m.LastMerge)
+
+	// merge之后记录新的数据文件列表
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	m, err = readManifest(fio.OSFS{}, dir)
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), m.LastMerge)
+	assert.Equal(t, db.seqNo, m.SeqNo)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// 多余的数据文件
+	extra := data.GetFileName(dir, m.Files[len(m.Files)-1]+1)
+	err = os.WriteFile(extra, nil, 0644)
+	assert.Nil(t, err)
+	_, err = OpenDB(opts)
+	assert.Equal(t, ErrManifestMismatch, err)
+	err = os.Remove(extra)
+	assert.Nil(t, err)
+
+	// 缺失的数据文件
+	missing := data.GetFileName(dir, m.Files[0])
+	err = os.Rename(missing, missing+".bak")
+	assert.Nil(t, err)
+	_, err = OpenDB(opts)
+	assert.Equal(t, ErrManifestMismatch, err)
+	err = os.Rename(missing+".bak", missing)
+	assert.Nil(t, err)
+
+	// 不兼容的元数据版本
+	m.Version = manifestVersion + 1
+	err = writeManifest(fio.OSFS{}, dir, m)
+	assert.Nil(t, err)
+	_, err = OpenDB(opts)
+	assert.Equal(t, ErrManifestIncompatible, err)
+	m.Version = manifestVersion
+	err = writeManifest(fio.OSFS{}, dir, m)
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+}
+
+func TestCheckManifestFiles(t *testing.T) {
+	m := &manifest{Files: []uint32{0, 1, 2}}
+	assert.Nil(t, checkManifestFiles(m, []int{0, 1, 2}))
+	// 最后一个文件可能还没有创建
+	assert.Nil(t, checkManifestFiles(m, []int{0, 1}))
+	assert.Equal(t, ErrManifestMismatch, checkManifestFiles(m, []int{0, 2}))
+	assert.Equal(t, ErrManifestMismatch, checkManifestFiles(m, []int{0, 1, 2, 3}))
+	assert.Equal(t, ErrManifestMismatch, checkManifestFiles(m, []int{0}))
+}
+
+func TestReadIndexType(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-manifest-index-type")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+
+	// 没有元数据
+	_, ok, err := ReadIndexType(opts)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	opts.IndexType = SkipList
+	db, err := OpenDB(opts)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// 与配置的索引类型无关，读取目录记录的索引类型
+	opts.IndexType = Btree
+	typ, ok, err := ReadIndexType(opts)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, SkipList, typ)
+}
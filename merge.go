@@ -2,7 +2,8 @@ package bitcask
 
 import (
 	"bitcask/data"
-	"bitcask/utils"
+	"bitcask/fio"
+	"context"
 	"io"
 	"os"
 	"path"
@@ -14,23 +15,37 @@ import (
 const (
 	mergeDirName     = "-merge"
 	mergeFinishedKey = "merge.finished"
+
+	// 旧的数据文件已经全部删除的标识，之后崩溃重新应用merge时只移动剩余的文件
+	mergeAppliedFileName = "merge-applied"
 )
 
 // 清理无效数据，生成Hint文件
 func (db *DB) Merge() error {
+	return db.MergeCtx(context.Background())
+}
+
+// 清理无效数据，ctx取消时放弃本次merge并返回ctx.Err()，未完成的merge目录在下次启动时被忽略
+func (db *DB) MergeCtx(ctx context.Context) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
 	// 如果当前db没有数据，直接返回
 	if db.activeFile == nil {
 		return nil
 	}
 
-	db.mu.Lock()
+	if err := db.lockCtx(ctx); err != nil {
+		return err
+	}
 	// 如果merge正在进行，直接返回
 	if db.isMerging {
 		db.mu.Unlock()
 		return ErrMergeIsProgressing
 	}
 
-	dirSize, err := utils.DirSize(db.opt.DirPath)
+	dirSize, err := fio.DirSize(db.opt.FS, db.opt.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
@@ -42,7 +57,7 @@ func (db *DB) Merge() error {
 	}
 
 	// 剩余磁盘空间是否能够容纳 merge 之后的数据集
-	availSize, err := utils.AvailableDiskSize()
+	availSize, err := db.opt.FS.AvailableSize(db.opt.DirPath)
 	if err != nil {
 		db.mu.Unlock()
 		return err
@@ -73,6 +88,9 @@ func (db *DB) Merge() error {
 	// 记录最近没有参与merge的文件ID
 	lastNonMergeFileID := db.activeFile.FileID
 
+	// 清理超出保留时间的旧版本，merge时不再重写
+	db.sweepHistory()
+
 	// 当前所有旧的数据文件就是需要merge的数据文件
 	var mergeFiles []*data.DataFile
 	for _, dataFile := range db.olderFiles {
@@ -88,14 +106,14 @@ func (db *DB) Merge() error {
 	mergePath := db.getMergePath()
 
 	// 如果merge目录存在，说明之前进行过merge，需要将目录删除
-	if _, err := os.Stat(mergePath); err == nil {
-		if err := os.RemoveAll(mergePath); err != nil {
+	if _, err := db.opt.FS.Stat(mergePath); err == nil {
+		if err := db.opt.FS.RemoveAll(mergePath); err != nil {
 			return err
 		}
 	}
 
 	// 新建一个merge目录，用于启动merge使用的数据库
-	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+	if err := db.opt.FS.MkdirAll(mergePath); err != nil {
 		return err
 	}
 
@@ -103,41 +121,72 @@ func (db *DB) Merge() error {
 	mergeOpt.DirPath = mergePath
 	// 如果merge中途出错，不应该Sync。可以自定义merge的Sync时间
 	mergeOpt.SyncWrites = false
+	// 重写的记录保留原有的写入时间，临时实例不需要记录历史版本
+	mergeOpt.HistoryVersions, mergeOpt.HistoryRetention = 0, 0
 
 	// 打开新的临时bitcask实例用于merge
 	mergeDB, err := OpenDB(mergeOpt)
 	if err != nil {
 		return err
 	}
+	// 任何情况下退出都需要关闭临时实例，释放merge目录的文件锁
+	defer func() {
+		_ = mergeDB.Close()
+	}()
 
 	// 打开Hint文件存储索引
-	hintFile, err := data.OpenHintFile(mergePath)
+	hintFile, err := data.OpenHintFile(db.opt.FS, mergePath)
 	if err != nil {
-		return nil
+		return err
 	}
+	defer func() {
+		_ = hintFile.Close()
+	}()
 
 	// 遍历需要merge的文件，取出记录重写有效数据
+	// 顺序扫描时预读，使用io_uring时多个读请求同时提交
 	for _, dataFile := range mergeFiles {
-
-		var offset int64 = 0
+		scanner, err := dataFile.NewScanner()
+		if err != nil {
+			return err
+		}
 
 		for {
-			logRecord, n, err := dataFile.ReadLogRecord(offset)
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			offset := scanner.Offset
+			logRecord, _, err := scanner.Next()
 			if err != nil {
 				if err == io.EOF {
 					break
 				}
 				return err
 			}
+			// 尾部校验记录不包含数据，merge之后的文件封存时重新生成
+			if logRecord.Type == data.LogRecordFileTrailer {
+				continue
+			}
 
-			// 解析得到实际key
+			// 解析得到实际key，并找到key所属命名空间的索引
 			realKey, _ := parseLogRecordKey(logRecord.Key)
-			logRecordPos := db.index.Get(realKey)
+			db.mu.RLock()
+			idx, _, key := db.resolveKey(realKey, logRecord.Flags, false)
+			historyKeys := db.historyKeysAt(logRecord, dataFile.FileID, offset)
+			db.mu.RUnlock()
+
+			var logRecordPos *data.LogRecordPos
+			if idx != nil {
+				logRecordPos = idx.Get(key)
+			}
 			// 将记录所在文件ID以及offset与索引位置进行比较。如果一致，表示该记录是有效数据，需要重写到merge目录中
 			if logRecordPos != nil && logRecordPos.Fid == dataFile.FileID && logRecordPos.Offset == offset {
-				// 确定有效数据，不需要重写事务序列号
-				// 清除事务标记
-				logRecord.Key = logRecordKeyWithSeqNo(realKey, nonTransactionSeqNo)
+				// 确定有效数据，清除事务标记，保留版本号
+				logRecord.Key = logRecordKeyWithSeqNo(realKey, logRecordPos.Version)
+				if logRecordPos.Version != nonTransactionSeqNo {
+					logRecord.Flags |= data.LogRecordVersioned
+				}
 				pos, err := mergeDB.appendLogRecord(logRecord)
 				if err != nil {
 					return err
@@ -145,11 +194,27 @@ func (db *DB) Merge() error {
 
 				// 将当前索引位置写到Hint文件中
 				// 格式与数据文件一致，将realKey和pos编码写入hintFile
-				if err := hintFile.WriteHintRecord(realKey, pos); err != nil {
+				if err := hintFile.WriteHintRecord(realKey, pos, logRecord.Flags); err != nil {
 					return err
 				}
+			} else if len(historyKeys) > 0 {
+				// 需要保留的历史版本，同样重写到merge目录中，并在Hint文件中标记为历史版本
+				_, version := parseLogRecordKey(logRecord.Key)
+				logRecord.Key = logRecordKeyWithSeqNo(realKey, version)
+				if version != nonTransactionSeqNo {
+					logRecord.Flags |= data.LogRecordVersioned
+				}
+				pos, err := mergeDB.appendLogRecord(logRecord)
+				if err != nil {
+					return err
+				}
+
+				for _, historyKey := range historyKeys {
+					if err := hintFile.WriteHistoryHintRecord(historyKey, pos, logRecord.Flags); err != nil {
+						return err
+					}
+				}
 			}
-			offset += n
 		}
 	}
 
@@ -161,12 +226,19 @@ func (db *DB) Merge() error {
 	if err := mergeDB.Sync(); err != nil {
 		return err
 	}
+	// merge完成文件持久化之前，merge目录中的其他文件项必须已经持久化
+	if err := db.opt.FS.SyncDir(mergePath); err != nil {
+		return err
+	}
 
 	// 新增merge完成文件
-	mergeFinishedFile, err := data.OpenHintFinishedFile(mergePath)
+	mergeFinishedFile, err := data.OpenHintFinishedFile(db.opt.FS, mergePath)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		_ = mergeFinishedFile.Close()
+	}()
 
 	mergeFinRecord := &data.LogRecord{
 		Key:   []byte(mergeFinishedKey),
@@ -182,7 +254,7 @@ func (db *DB) Merge() error {
 		return err
 	}
 
-	return nil
+	return db.opt.FS.SyncDir(mergePath)
 }
 
 // 获取merge目录
@@ -197,29 +269,48 @@ func (db *DB) loadMergeFiles() error {
 	mergePath := db.getMergePath()
 
 	// merge目录不存在，不需要加载直接返回
-	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+	if _, err := db.opt.FS.Stat(mergePath); os.IsNotExist(err) {
 		return nil
 	}
 
+	// 只读进程正在使用数据文件时不替换，保留merge目录等待下次启动
+	readerLock := db.opt.FS.NewLock(filepath.Join(db.opt.DirPath, readerLockName))
+	hold, err := readerLock.TryLock()
+	if err != nil {
+		return err
+	}
+	if !hold {
+		return nil
+	}
+	defer func() {
+		_ = readerLock.Unlock()
+	}()
+
 	defer func() {
 		// 删除merge目录
-		_ = os.RemoveAll(mergePath)
+		_ = db.opt.FS.RemoveAll(mergePath)
 	}()
 
-	entries, err := os.ReadDir(mergePath)
+	entries, err := db.opt.FS.ReadDir(mergePath)
 	if err != nil {
 		return err
 	}
 
 	// 查找标识merge完成的文件，判断merge是否处理完成
-	var mergeFinished bool = false
+	var mergeFinished, mergeApplied bool
 	var mergeFileNames []string
 	for _, entry := range entries {
-		if entry.Name() == data.SeqNoFileName || entry.Name() == fileLockName {
+		if entry.Name() == data.SeqNoFileName || entry.Name() == fileLockName || entry.Name() == readerLockName || entry.Name() == manifestFileName {
 			continue
 		}
+		if entry.Name() == mergeAppliedFileName {
+			mergeApplied = true
+			continue
+		}
+		// mergeFinished文件最后移动，移动完成之前崩溃可以重新应用本次merge
 		if entry.Name() == data.MergeFinishedFileName {
 			mergeFinished = true
+			continue
 		}
 		mergeFileNames = append(mergeFileNames, entry.Name())
 	}
@@ -230,19 +321,19 @@ func (db *DB) loadMergeFiles() error {
 
 	// 如果merge完成，删除旧的数据文件，用merge目录的数据文件替代
 	// 打开mergeFinished文件，找到最近没有参与merge的文件ID。在该ID之前的文件需要删除
-	nonMergeFileID, err := db.getNonMergeFileID(mergePath)
+	nonMergeFileID, err := getNonMergeFileID(db.opt.FS, mergePath)
+	// 写入merge完成记录之前崩溃，文件存在但记录不完整，本次merge作废
+	if err == io.EOF || err == data.ErrInvalidCRC {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	// 删除旧的数据文件
-	var fileId uint32 = 0
-	for ; fileId < nonMergeFileID; fileId++ {
-		fileName := data.GetFileName(db.opt.DirPath, fileId)
-		if _, err := os.Stat(fileName); err == nil {
-			if err := os.Remove(fileName); err != nil {
-				return err
-			}
+	// 上次应用merge时已经删除旧的数据文件，数据目录中小于nonMergeFileID的文件可能已经是merge之后的文件
+	if !mergeApplied {
+		if err := db.removeMergedFiles(mergePath, nonMergeFileID); err != nil {
+			return err
 		}
 	}
 
@@ -251,22 +342,83 @@ func (db *DB) loadMergeFiles() error {
 		srcPath := filepath.Join(mergePath, mergeFileName)
 		dstPath := filepath.Join(db.opt.DirPath, mergeFileName)
 		// Rename相当于Linux的mv指令
-		if err := os.Rename(srcPath, dstPath); err != nil {
+		if err := db.opt.FS.Rename(srcPath, dstPath); err != nil {
 			return err
 		}
 	}
+	// 其他文件的移动持久化之后再移动mergeFinished文件
+	if err := db.syncMergeDirs(mergePath); err != nil {
+		return err
+	}
+	srcPath := filepath.Join(mergePath, data.MergeFinishedFileName)
+	dstPath := filepath.Join(db.opt.DirPath, data.MergeFinishedFileName)
+	if err := db.opt.FS.Rename(srcPath, dstPath); err != nil {
+		return err
+	}
+	return db.syncMergeDirs(mergePath)
+}
 
-	return nil
+// 持久化数据目录和merge目录中的文件项
+func (db *DB) syncMergeDirs(mergePath string) error {
+	if err := db.opt.FS.SyncDir(db.opt.DirPath); err != nil {
+		return err
+	}
+	return db.opt.FS.SyncDir(mergePath)
+}
+
+// 在元数据中记录merge之后的数据文件，删除参与merge的旧数据文件，完成后写入标识文件
+func (db *DB) removeMergedFiles(mergePath string, nonMergeFileID uint32) error {
+	// 先在元数据中记录merge之后的数据文件
+	fileIds, err := listDataFileIds(db.opt.FS, db.opt.DirPath)
+	if err != nil {
+		return err
+	}
+	mergedFileIds, err := listDataFileIds(db.opt.FS, mergePath)
+	if err != nil {
+		return err
+	}
+	var liveFileIds []uint32
+	for _, fid := range fileIds {
+		if uint32(fid) >= nonMergeFileID {
+			liveFileIds = append(liveFileIds, uint32(fid))
+		}
+	}
+	for _, fid := range mergedFileIds {
+		liveFileIds = append(liveFileIds, uint32(fid))
+	}
+	if err := db.saveMergedManifest(liveFileIds); err != nil {
+		return err
+	}
+
+	// 删除旧的数据文件
+	var fileId uint32 = 0
+	for ; fileId < nonMergeFileID; fileId++ {
+		fileName := data.GetFileName(db.opt.DirPath, fileId)
+		if _, err := db.opt.FS.Stat(fileName); err == nil {
+			if err := db.opt.FS.Remove(fileName); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 旧数据文件的删除持久化之后再写入标识文件
+	if err := db.opt.FS.SyncDir(db.opt.DirPath); err != nil {
+		return err
+	}
+	if err := db.opt.FS.WriteFile(filepath.Join(mergePath, mergeAppliedFileName), nil); err != nil {
+		return err
+	}
+	return db.opt.FS.SyncDir(mergePath)
 }
 
 // 从hint文件中加载索引
 func (db *DB) loadIndexFromHintFile() error {
 	// 查看hint文件是否存在
-	if _, err := os.Stat(filepath.Join(db.opt.DirPath, data.HintFileName)); os.IsNotExist(err) {
+	if _, err := db.opt.FS.Stat(filepath.Join(db.opt.DirPath, data.HintFileName)); os.IsNotExist(err) {
 		return nil
 	}
 
-	hintFile, err := data.OpenHintFile(db.opt.DirPath)
+	hintFile, err := data.OpenHintFile(db.opt.FS, db.opt.DirPath)
 	if err != nil {
 		return err
 	}
@@ -281,7 +433,15 @@ func (db *DB) loadIndexFromHintFile() error {
 			return err
 		}
 		pos := data.DecodeLogRecordPos(hintRecord.Value)
-		db.index.Put(hintRecord.Key, pos)
+		idx, ns, key := db.resolveKey(hintRecord.Key, hintRecord.Flags, true)
+		if hintRecord.Type == data.LogRecordHistory {
+			db.addHistory(ns, key, pos)
+		} else {
+			idx.Put(key, pos)
+		}
+		if pos.Version > db.seqNo {
+			db.seqNo = pos.Version
+		}
 
 		offset += n
 	}
@@ -289,8 +449,8 @@ func (db *DB) loadIndexFromHintFile() error {
 	return nil
 }
 
-func (db *DB) getNonMergeFileID(mergePath string) (uint32, error) {
-	mergeFinishedFile, err := data.OpenHintFinishedFile(mergePath)
+func getNonMergeFileID(fsys fio.FS, mergePath string) (uint32, error) {
+	mergeFinishedFile, err := data.OpenHintFinishedFile(fsys, mergePath)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,101 @@
+package bitcask
+
+import (
+	"bitcask/index"
+	"os"
+	"path/filepath"
+)
+
+// 离线迁移：以目录中记录的索引类型打开数据库，重建目标索引后关闭
+// 目录中没有记录时以opt.IndexType作为当前索引类型
+func MigrateIndex(opt Options, typ IndexerType) error {
+	opt.FS = opt.fileSystem()
+	curType, ok, err := ReadIndexType(opt)
+	if err != nil {
+		return err
+	}
+	if ok {
+		opt.IndexType = curType
+	}
+	opt.ReadOnly = false
+
+	db, err := OpenDB(opt)
+	if err != nil {
+		return err
+	}
+	if err := db.MigrateIndex(typ); err != nil {
+		_ = db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+// 在线迁移：根据当前索引中的数据位置构建目标索引，记录新的索引类型之后替换，迁移期间阻塞读写
+func (db *DB) MigrateIndex(typ IndexerType) error {
+	if db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+	if _, ok := indexTypeNames[typ]; !ok {
+		return ErrIndexTypeUnsupported
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if typ == db.opt.IndexType {
+		return nil
+	}
+
+	bptreePath := filepath.Join(db.opt.DirPath, index.BPTreeIndexFileName)
+	if typ == BPlusTree {
+		if len(db.namespaces) > 0 {
+			return ErrNamespaceUnsupported
+		}
+		if db.historyEnabled() {
+			return ErrIndexTypeUnsupported
+		}
+		// 删除之前迁移残留的索引文件
+		if err := db.opt.FS.Remove(bptreePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	newIndex := index.NewIndexer(typ, db.opt.DirPath, db.opt.SyncWrites)
+	it := db.index.Iterator(false)
+	for it.Rewind(); it.Valid(); it.Next() {
+		// B+树迭代器返回的key在事务结束后失效，需要拷贝
+		key := append([]byte(nil), it.Key()...)
+		newIndex.Put(key, it.Value())
+	}
+	it.Close()
+
+	// 先记录新的索引类型再替换索引，记录失败时继续使用旧的索引
+	// B+树模式启动时不会重放数据文件，记录之前索引文件必须已经持久化
+	oldIndex, oldType := db.index, db.opt.IndexType
+	var err error
+	if bpt, ok := newIndex.(*index.BPlusTree); ok {
+		err = bpt.Sync()
+	}
+	if err == nil {
+		db.opt.IndexType = typ
+		err = db.saveManifest()
+	}
+	if err != nil {
+		db.opt.IndexType = oldType
+		_ = newIndex.Close()
+		if typ == BPlusTree {
+			_ = db.opt.FS.Remove(bptreePath)
+		}
+		return err
+	}
+	db.index = newIndex
+
+	// 新的索引已经生效，关闭旧的索引失败时只返回错误；中途崩溃时残留的B+树索引文件不会被使用
+	closeErr := oldIndex.Close()
+	if oldType == BPlusTree {
+		if err := db.opt.FS.Remove(bptreePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return closeErr
+}
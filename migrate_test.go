@@ -0,0 +1,137 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"bitcask/index"
+	"bitcask/utils"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateIndex(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-migrate-1")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// 索引类型与目录不一致
+	bptOpts := opts
+	bptOpts.IndexType = BPlusTree
+	_, err = OpenDB(bptOpts)
+	assert.Equal(t, ErrIndexTypeMismatch, err)
+
+	// 离线迁移到B+树索引
+	err = MigrateIndex(bptOpts, BPlusTree)
+	assert.Nil(t, err)
+	_, err = OpenDB(opts)
+	assert.Equal(t, ErrIndexTypeMismatch, err)
+
+	db, err = OpenDB(bptOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(100), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	// 在线迁移回内存索引
+	err = db.MigrateIndex(ART)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(db.ListKeys()))
+	_, err = os.Stat(filepath.Join(dir, index.BPTreeIndexFileName))
+	assert.True(t, os.IsNotExist(err))
+	err = db.Put(utils.GetTestKey(101), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	artOpts := opts
+	artOpts.IndexType = ART
+	db, err = OpenDB(artOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, 102, len(db.ListKeys()))
+}
+
+func TestDB_NewWriteBatch_BPlusTreeWithoutSeqNo(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-migrate-2")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+	_, version, err := db.GetWithVersion(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// 模拟没有正常关闭，序列号从数据文件中恢复
+	err = db.Close()
+	assert.Nil(t, err)
+	err = os.Remove(filepath.Join(dir, data.SeqNoFileName))
+	assert.Nil(t, err)
+
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(2), utils.RandomValue(24))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+	_, version2, err := db.GetWithVersion(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Greater(t, version2, version)
+}
+
+func TestDB_MigrateIndex_SaveManifestFailed(t *testing.T) {
+	opts := DefaultOptions
+	fsys := fio.NewFaultFS()
+	opts.DirPath = "/bitcask-go-migrate-3"
+	opts.FS = fsys
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+
+	// 记录新的索引类型失败时继续使用旧的索引
+	fsys.InjectAfter(1, fio.FaultError)
+	err = db.MigrateIndex(ART)
+	assert.Equal(t, fio.ErrInjectedFault, err)
+	assert.Equal(t, Btree, db.opt.IndexType)
+	assert.IsType(t, &index.BTree{}, db.index)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	fsys.Crash(false)
+	err = db.MigrateIndex(ART)
+	assert.Nil(t, err)
+	m, err := readManifest(fsys, opts.DirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, "art", m.IndexType)
+	assert.Equal(t, 100, len(db.ListKeys()))
+}
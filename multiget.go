@@ -0,0 +1,105 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"sort"
+	"sync"
+)
+
+// 批量读取多个key，返回的values和errs与keys一一对应
+func (db *DB) MultiGet(keys [][]byte) ([][]byte, []error) {
+	return db.MultiGetWithOptions(keys, DefaultMultiGetOptions)
+}
+
+// 批量读取多个key，在一把锁内查找所有key的位置，并按 (Fid, Offset) 排序读取以提高局部性
+func (db *DB) MultiGetWithOptions(keys [][]byte, opt MultiGetOptions) ([][]byte, []error) {
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// 查找所有key的位置
+	type readTask struct {
+		i   int
+		pos *data.LogRecordPos
+	}
+	tasks := make([]readTask, 0, len(keys))
+	for i, key := range keys {
+		if len(key) == 0 {
+			errs[i] = ErrKeyIsEmpty
+			continue
+		}
+		pos := db.index.Get(key)
+		if pos == nil {
+			errs[i] = ErrKeyNotFound
+			continue
+		}
+		tasks = append(tasks, readTask{i: i, pos: pos})
+	}
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].pos.Fid != tasks[j].pos.Fid {
+			return tasks[i].pos.Fid < tasks[j].pos.Fid
+		}
+		return tasks[i].pos.Offset < tasks[j].pos.Offset
+	})
+
+	// 一个区间内的读请求批量提交，使用io_uring时可以同时处理多个IO
+	read := func(tasks []readTask) {
+		files := make([]*data.DataFile, 0, len(tasks))
+		positions := make([]*data.LogRecordPos, 0, len(tasks))
+		indexes := make([]int, 0, len(tasks))
+		for _, task := range tasks {
+			var dataFile *data.DataFile
+			if db.activeFile != nil && task.pos.Fid == db.activeFile.FileID {
+				dataFile = db.activeFile
+			} else {
+				dataFile = db.olderFiles[task.pos.Fid]
+			}
+			if dataFile == nil {
+				errs[task.i] = ErrDataFileNotFound
+				continue
+			}
+			files = append(files, dataFile)
+			positions = append(positions, task.pos)
+			indexes = append(indexes, task.i)
+		}
+
+		records, readErrs := data.ReadLogRecordsAt(files, positions)
+		for j, i := range indexes {
+			switch {
+			case readErrs[j] != nil:
+				errs[i] = readErrs[j]
+			case records[j].Type == data.LogRecordDeleted:
+				errs[i] = ErrKeyNotFound
+			default:
+				values[i] = records[j].Value
+			}
+		}
+	}
+
+	// 按顺序切分为连续的区间，每个协程内部批量读取
+	workers := opt.Parallelism
+	if workers <= 1 || len(tasks) <= 1 {
+		read(tasks)
+		return values, errs
+	}
+	if workers > len(tasks) {
+		workers = len(tasks)
+	}
+
+	wg := new(sync.WaitGroup)
+	chunk := (len(tasks) + workers - 1) / workers
+	for start := 0; start < len(tasks); start += chunk {
+		end := min(start+chunk, len(tasks))
+		wg.Add(1)
+		go func(tasks []readTask) {
+			defer wg.Done()
+			read(tasks)
+		}(tasks[start:end])
+	}
+	wg.Wait()
+
+	return values, errs
+}
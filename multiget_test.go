@@ -0,0 +1,65 @@
+package bitcask
+
+import (
+	"bitcask/fio"
+	"bitcask/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_MultiGet(t *testing.T) {
+	// io_uring下同一区间的读请求批量提交
+	for name, typ := range map[string]fio.FileIOType{"FileIO": fio.StandardFIO, "IOUring": fio.IOUringFIO} {
+		t.Run(name, func(t *testing.T) {
+			testMultiGet(t, typ)
+		})
+	}
+}
+
+func testMultiGet(t *testing.T, ioType fio.FileIOType) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-multiget")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	opts.IOType = ioType
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	// 数据分布在多个数据文件中
+	values := make(map[int][]byte)
+	for i := 0; i < 1000; i++ {
+		values[i] = utils.RandomValue(128)
+		err := db.Put(utils.GetTestKey(i), values[i])
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(5))
+	assert.Nil(t, err)
+
+	// 逆序读取，包含不存在、已删除和空的key
+	var keys [][]byte
+	for i := 999; i >= 0; i -= 3 {
+		keys = append(keys, utils.GetTestKey(i))
+	}
+	keys = append(keys, utils.GetTestKey(5), utils.GetTestKey(2000), nil)
+
+	for _, parallelism := range []int{1, 4} {
+		res, errs := db.MultiGetWithOptions(keys, MultiGetOptions{Parallelism: parallelism})
+		assert.Equal(t, len(keys), len(res))
+		assert.Equal(t, len(keys), len(errs))
+		for i := 0; i < len(keys)-3; i++ {
+			assert.Nil(t, errs[i])
+			assert.Equal(t, values[999-3*i], res[i])
+		}
+		assert.Equal(t, ErrKeyNotFound, errs[len(keys)-3])
+		assert.Equal(t, ErrKeyNotFound, errs[len(keys)-2])
+		assert.Equal(t, ErrKeyIsEmpty, errs[len(keys)-1])
+	}
+
+	res, errs := db.MultiGet(nil)
+	assert.Equal(t, 0, len(res))
+	assert.Equal(t, 0, len(errs))
+}
@@ -0,0 +1,226 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/index"
+	"context"
+	"encoding/binary"
+)
+
+// 命名空间，与数据库中的其他命名空间共用同一份日志文件和文件锁，但拥有独立的内存索引
+// 命名空间中的记录key编码为 nameSize | name | key，并在记录类型中标记 LogRecordNamespaced
+type Namespace struct {
+	name        string
+	db          *DB
+	index       index.Indexer
+	reclaimSize int64 // 命名空间中可以进行merge回收的数据量（B）
+}
+
+// 获取指定名称的命名空间，不存在时创建
+// 索引类型由 Options.NamespaceIndexTypes 指定，默认与数据库的索引类型一致
+func (db *DB) Namespace(name string) (*Namespace, error) {
+	if name == "" {
+		return nil, ErrNamespaceIsEmpty
+	}
+
+	// B+树索引不从数据文件中加载，无法恢复命名空间的索引
+	if db.opt.IndexType == BPlusTree {
+		return nil, ErrNamespaceUnsupported
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.getNamespace(name, true), nil
+}
+
+// 命名空间名称
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+func (ns *Namespace) Put(key []byte, value []byte) error {
+	if ns.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	ns.db.mu.Lock()
+	defer ns.db.mu.Unlock()
+
+	logRecord := &data.LogRecord{
+		Key:   logRecordKeyWithSeqNo(encodeNamespaceKey(ns.name, key), ns.db.nextSeqNo()),
+		Value: value,
+		Type:  data.LogRecordNormal,
+		Flags: data.LogRecordNamespaced | data.LogRecordVersioned,
+	}
+
+	pos, err := ns.db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+
+	if oldPos := ns.index.Put(key, pos); oldPos != nil {
+		ns.db.addReclaimSize(ns, oldPos.Size)
+	}
+	return nil
+}
+
+func (ns *Namespace) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+
+	return ns.db.getValueByPosition(ns.index.Get(key))
+}
+
+func (ns *Namespace) Delete(key []byte) error {
+	if ns.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	ns.db.mu.Lock()
+	defer ns.db.mu.Unlock()
+
+	// key 在索引中不存在
+	if pos := ns.index.Get(key); pos == nil {
+		return nil
+	}
+
+	logRecord := &data.LogRecord{
+		Key:   logRecordKeyWithSeqNo(encodeNamespaceKey(ns.name, key), ns.db.nextSeqNo()),
+		Type:  data.LogRecordDeleted,
+		Flags: data.LogRecordNamespaced | data.LogRecordVersioned,
+	}
+
+	pos, err := ns.db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	ns.db.addReclaimSize(ns, pos.Size)
+
+	if oldPos, _ := ns.index.Delete(key); oldPos != nil {
+		ns.db.addReclaimSize(ns, oldPos.Size)
+	}
+	return nil
+}
+
+// 删除命名空间中区间 [start, end) 内的所有key
+func (ns *Namespace) DeleteRange(start, end []byte) error {
+	return ns.db.deleteRange(ns, start, end)
+}
+
+// 删除命名空间中所有以prefix为前缀的key
+func (ns *Namespace) DeletePrefix(prefix []byte) error {
+	if ns.db.opt.ReadOnly {
+		return ErrReadOnly
+	}
+
+	if len(prefix) == 0 {
+		return ErrKeyIsEmpty
+	}
+
+	return ns.db.deleteRange(ns, prefix, prefixSuccessor(prefix))
+}
+
+// 初始化命名空间迭代器
+func (ns *Namespace) NewIterator(opt IteratorOptions) *Iterator {
+	return ns.db.newIterator(ns.index, opt)
+}
+
+// 获取命名空间中所有key
+func (ns *Namespace) ListKeys() [][]byte {
+	return listKeys(ns.index)
+}
+
+// 获取命名空间中所有数据，并执行用户指定操作，直到操作返回false推出循环
+func (ns *Namespace) Fold(fn func(key []byte, value []byte) bool) error {
+	return ns.db.fold(context.Background(), ns.index, fn)
+}
+
+// 返回命名空间统计信息，数据文件数量和磁盘空间为所有命名空间共享
+func (ns *Namespace) Stat() *Stat {
+	stat := ns.db.Stat()
+
+	ns.db.mu.RLock()
+	defer ns.db.mu.RUnlock()
+
+	stat.KeyNum = uint(ns.index.Size())
+	stat.ReclaimSize = ns.reclaimSize
+	return stat
+}
+
+// 查找命名空间，create为true时不存在则创建
+// 访问此方法前必须持有互斥锁
+func (db *DB) getNamespace(name string, create bool) *Namespace {
+	if ns, ok := db.namespaces[name]; ok {
+		return ns
+	}
+	if !create {
+		return nil
+	}
+
+	indexType := db.opt.IndexType
+	if typ, ok := db.opt.NamespaceIndexTypes[name]; ok {
+		indexType = typ
+	}
+
+	ns := &Namespace{
+		name:  name,
+		db:    db,
+		index: index.NewIndexer(indexType, db.opt.DirPath, db.opt.SyncWrites),
+	}
+	db.namespaces[name] = ns
+	return ns
+}
+
+// 根据日志记录的标志位找到key所属的索引，返回索引、命名空间（默认命名空间为nil）和实际的key
+// 命名空间不存在且create为false时返回的索引为nil
+func (db *DB) resolveKey(key []byte, flags data.LogRecordFlag, create bool) (index.Indexer, *Namespace, []byte) {
+	if flags&data.LogRecordNamespaced == 0 {
+		return db.index, nil, key
+	}
+
+	name, realKey := decodeNamespaceKey(key)
+	ns := db.getNamespace(name, create)
+	if ns == nil {
+		return nil, nil, realKey
+	}
+	return ns.index, ns, realKey
+}
+
+// 累加可回收的数据量，ns为nil表示默认命名空间
+func (db *DB) addReclaimSize(ns *Namespace, size uint32) {
+	db.reclaimSize += int64(size)
+	if ns != nil {
+		ns.reclaimSize += int64(size)
+	}
+}
+
+// 编码命名空间中的key
+//
+//	|  nameSize  |  name  |  key  |
+func encodeNamespaceKey(name string, key []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen32+len(name)+len(key))
+	n := binary.PutUvarint(buf, uint64(len(name)))
+	n += copy(buf[n:], name)
+	n += copy(buf[n:], key)
+	return buf[:n]
+}
+
+// 解析命名空间中的key，获取命名空间名称和实际的key
+func decodeNamespaceKey(key []byte) (string, []byte) {
+	nameSize, n := binary.Uvarint(key)
+	name := string(key[n : n+int(nameSize)])
+	return name, key[n+int(nameSize):]
+}
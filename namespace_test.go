@@ -0,0 +1,153 @@
+package bitcask
+
+import (
+	"bitcask/utils"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Namespace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-1")
+	opts.DirPath = dir
+	opts.NamespaceIndexTypes = map[string]IndexerType{"orders": ART}
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	_, err = db.Namespace("")
+	assert.Equal(t, ErrNamespaceIsEmpty, err)
+
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	orders, err := db.Namespace("orders")
+	assert.Nil(t, err)
+
+	// 相同的key在不同命名空间中相互独立
+	err = db.Put([]byte("key"), []byte("default"))
+	assert.Nil(t, err)
+	err = users.Put([]byte("key"), []byte("users"))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		err := orders.Put(utils.GetTestKey(i), utils.RandomValue(10))
+		assert.Nil(t, err)
+	}
+
+	val, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), val)
+	val, err = users.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("users"), val)
+	_, err = orders.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = users.Delete([]byte("key"))
+	assert.Nil(t, err)
+	_, err = users.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("key"))
+	assert.Nil(t, err)
+
+	err = orders.DeleteRange(utils.GetTestKey(0), utils.GetTestKey(5))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(db.ListKeys()))
+	assert.Equal(t, 0, len(users.ListKeys()))
+	assert.Equal(t, 5, len(orders.ListKeys()))
+
+	stat := users.Stat()
+	assert.Equal(t, uint(0), stat.KeyNum)
+	assert.True(t, stat.ReclaimSize > 0)
+
+	// 重启之后命名空间的数据独立恢复
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	db = db2
+
+	orders2, err := db2.Namespace("orders")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(orders2.ListKeys()))
+	val, err = db2.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), val)
+
+	var count int
+	err = orders2.Fold(func(key []byte, value []byte) bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, count)
+}
+
+func TestDB_Namespace_WriteBatch(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-namespace-2")
+	opts.DirPath = dir
+	opts.DataFileMergeRatio = 0
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	users, err := db.Namespace("users")
+	assert.Nil(t, err)
+	orders, err := db.Namespace("orders")
+	assert.Nil(t, err)
+
+	// 一个批次同时写入多个命名空间
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put([]byte("key"), []byte("default"))
+	assert.Nil(t, err)
+	err = wb.PutIn(users, []byte("key"), []byte("users"))
+	assert.Nil(t, err)
+	err = wb.PutIn(orders, []byte("key"), []byte("orders"))
+	assert.Nil(t, err)
+
+	_, err = users.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	val, err := users.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("users"), val)
+	val, err = orders.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("orders"), val)
+
+	wb2 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb2.DeleteIn(orders, []byte("key"))
+	assert.Nil(t, err)
+	err = wb2.Commit()
+	assert.Nil(t, err)
+
+	// merge 之后重启
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := OpenDB(opts)
+	assert.Nil(t, err)
+	db = db2
+
+	users2, err := db2.Namespace("users")
+	assert.Nil(t, err)
+	val, err = users2.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("users"), val)
+	orders2, err := db2.Namespace("orders")
+	assert.Nil(t, err)
+	_, err = orders2.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err = db2.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("default"), val)
+}
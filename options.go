@@ -1,6 +1,11 @@
 package bitcask
 
-import "os"
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"os"
+	"time"
+)
 
 type Options struct {
 	DirPath            string // 数据库数据目录
@@ -10,6 +15,54 @@ type Options struct {
 	IndexType          IndexerType
 	MMapAtStartUp      bool    // 启动数据库时是否使用MMap加载数据文件
 	DataFileMergeRatio float32 // 数据文件开启merge的阈值
+
+	// 命名空间使用的索引类型，未指定的命名空间与IndexType一致，不支持BPlusTree
+	NamespaceIndexTypes map[string]IndexerType
+
+	// 历史版本模式：保留每个key最近的HistoryVersions个旧版本，或写入时间在HistoryRetention之内的旧版本
+	// 两者都为0表示关闭，旧版本在merge时会被保留。仅默认命名空间支持，不支持BPlusTree
+	HistoryVersions  int
+	HistoryRetention time.Duration
+
+	// 只读模式：不获取写进程的文件锁，可以与写进程同时打开同一个数据目录，不支持BPlusTree
+	// 所有写操作返回ErrReadOnly，通过Refresh加载写进程新追加的数据
+	ReadOnly bool
+
+	// 运行时数据文件使用的IO类型，默认为标准文件IO。fio.MemoryMapRW使活跃文件和读取都保持内存映射
+	// fio.BufferedFIO合并多次追加写，未Sync的数据在进程崩溃时会丢失
+	// fio.DirectFIO绕过页缓存写入，并按DataFileSize预分配新的数据文件，仅支持Linux
+	// fio.IOUringFIO时MultiGet和merge的读请求批量提交到io_uring；内核不支持时退化为标准文件IO
+	// 启动时仍由MMapAtStartUp决定，只读模式总是使用标准文件IO
+	IOType fio.FileIOType
+
+	// 旧的数据文件不会再被修改，在整个生命周期内保持只读内存映射，读取时不需要系统调用
+	MMapOlderFiles bool
+
+	// 数据目录所在的文件系统，merge目录、备份和检查点也在其中。为nil时使用操作系统的文件系统
+	FS fio.FS
+
+	// 完全在内存中运行：FS为nil时使用新的fio.MemFS，不访问磁盘，关闭之后数据丢失。不支持BPlusTree
+	InMemory bool
+
+	// 新写入记录和封存文件的尾部校验使用的算法，默认为CRC32-IEEE。已有的记录按各自记录的算法校验
+	// 无论使用哪种算法，写入的记录都带有标志位，数据目录不能再由旧版本打开
+	Checksum data.ChecksumType
+
+	// 新写入记录的编码格式，默认为data.RecordFormatV1。已有的记录按各自的格式读取
+	// data.RecordFormatV2使用定长header并总是记录写入时间。两种格式都不支持降级到旧版本
+	RecordFormat data.RecordFormat
+}
+
+// 未指定文件系统时，根据InMemory选择内存文件系统或操作系统的文件系统
+func (opt Options) fileSystem() fio.FS {
+	switch {
+	case opt.FS != nil:
+		return opt.FS
+	case opt.InMemory:
+		return fio.NewMemFS()
+	default:
+		return fio.OSFS{}
+	}
 }
 
 type IndexerType = int8
@@ -18,6 +71,7 @@ const (
 	Btree IndexerType = iota + 1
 	ART
 	BPlusTree
+	SkipList
 )
 
 var DefaultOptions = Options{
@@ -28,6 +82,7 @@ var DefaultOptions = Options{
 	IndexType:          Btree,
 	MMapAtStartUp:      true,
 	DataFileMergeRatio: 0.5,
+	IOType:             fio.StandardFIO,
 }
 
 // 批量写配置项
@@ -39,15 +94,33 @@ type WriteBatchOptions struct {
 	SyncWrites bool
 }
 
-// 迭代器配置项，指定需要遍历的Key前缀以及遍历方向
+// 迭代器配置项，指定需要遍历的Key前缀、区间、数量以及遍历方向
 type IteratorOptions struct {
-	Prefix  []byte // 默认为空
-	Reverse bool   // 默认为false正向
+	Prefix     []byte // 默认为空
+	Reverse    bool   // 默认为false正向
+	LowerBound []byte // 遍历区间下界（包含），默认为空表示不限制
+	UpperBound []byte // 遍历区间上界（不包含），默认为空表示不限制
+	Limit      int    // 最多遍历的key数量，默认为0表示不限制
+	KeysOnly   bool   // 只遍历key，不读取value
 }
 
 var DefaultIteratorOptions = IteratorOptions{
-	Prefix:  nil,
-	Reverse: false,
+	Prefix:     nil,
+	Reverse:    false,
+	LowerBound: nil,
+	UpperBound: nil,
+	Limit:      0,
+	KeysOnly:   false,
+}
+
+// 批量读配置项
+type MultiGetOptions struct {
+	// 并发读取的协程数量，小于等于1表示按位置顺序串行读取
+	Parallelism int
+}
+
+var DefaultMultiGetOptions = MultiGetOptions{
+	Parallelism: 1,
 }
 
 var DefaultWriteBatchOptions = WriteBatchOptions{
@@ -0,0 +1,284 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/fio"
+	"bitcask/utils"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ReadOnly(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+
+	// 1.写进程持有文件锁时打开只读实例
+	roOpts := opts
+	roOpts.ReadOnly = true
+	ro, err := OpenDB(roOpts)
+	assert.Nil(t, err)
+	assert.NotNil(t, ro)
+	assert.Equal(t, 100, len(ro.ListKeys()))
+
+	// 2.拒绝写操作
+	err = ro.Put(utils.GetTestKey(1000), utils.RandomValue(24))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.Delete(utils.GetTestKey(1))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.Merge()
+	assert.Equal(t, ErrReadOnly, err)
+	wb := ro.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(1000), utils.RandomValue(24))
+	assert.Equal(t, ErrReadOnly, err)
+	err = wb.Commit()
+	assert.Equal(t, ErrReadOnly, err)
+
+	// 3.写进程追加数据，跨越多个数据文件
+	for i := 100; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Put(utils.GetTestKey(2000), []byte("batch"))
+	assert.Nil(t, err)
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 100, len(ro.ListKeys()))
+	err = ro.Refresh()
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(ro.ListKeys()))
+	_, err = ro.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	val, err := ro.Get(utils.GetTestKey(2000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("batch"), val)
+
+	// 4.关闭只读实例不写入序列号文件
+	err = ro.Close()
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, data.SeqNoFileName))
+	assert.True(t, os.IsNotExist(err))
+
+	// 5.数据目录不存在
+	roOpts.DirPath = filepath.Join(dir, "not-exist")
+	_, err = OpenDB(roOpts)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDB_ReadOnly_MMapOlderFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly-mmap")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	roOpts := opts
+	roOpts.ReadOnly = true
+	roOpts.MMapOlderFiles = true
+	ro, err := OpenDB(roOpts)
+	assert.Nil(t, err)
+	defer ro.Close()
+
+	// 写进程多次切换活跃文件，只读实例刷新时重新映射旧的数据文件
+	values := make(map[int][]byte)
+	for round := 0; round < 3; round++ {
+		for i := round * 500; i < (round+1)*500; i++ {
+			values[i] = utils.RandomValue(128)
+			err := db.Put(utils.GetTestKey(i), values[i])
+			assert.Nil(t, err)
+		}
+		err = ro.Refresh()
+		assert.Nil(t, err)
+		for i := 0; i < (round+1)*500; i++ {
+			val, err := ro.Get(utils.GetTestKey(i))
+			assert.Nil(t, err)
+			assert.Equal(t, values[i], val)
+		}
+	}
+	assert.True(t, len(ro.olderFiles) > 1)
+	for _, dataFile := range ro.olderFiles {
+		_, ok := dataFile.IoManager.(*fio.MMap)
+		assert.True(t, ok)
+	}
+}
+
+func TestDB_ReadOnly_Mutators(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly-mutators")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+	err = db.Put(utils.GetTestKey(1), []byte("value"))
+	assert.Nil(t, err)
+
+	roOpts := opts
+	roOpts.ReadOnly = true
+	ro, err := OpenDB(roOpts)
+	assert.Nil(t, err)
+	defer ro.Close()
+
+	// 不需要追加记录的写操作同样返回ErrReadOnly
+	err = ro.Delete(utils.GetTestKey(2))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.DeleteCtx(context.Background(), utils.GetTestKey(2))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.PutCtx(context.Background(), utils.GetTestKey(2), []byte("value"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.DeleteRange([]byte("not-exist-a"), []byte("not-exist-b"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.DeletePrefix([]byte("not-exist"))
+	assert.Equal(t, ErrReadOnly, err)
+
+	ok, err := ro.CompareAndSwap(utils.GetTestKey(1), []byte("mismatch"), []byte("value"))
+	assert.Equal(t, ErrReadOnly, err)
+	assert.False(t, ok)
+	ok, err = ro.PutIfAbsent(utils.GetTestKey(1), []byte("value"))
+	assert.Equal(t, ErrReadOnly, err)
+	assert.False(t, ok)
+	ok, err = ro.PutIfVersion(utils.GetTestKey(1), []byte("value"), 1000)
+	assert.Equal(t, ErrReadOnly, err)
+	assert.False(t, ok)
+	err = ro.Update(utils.GetTestKey(1), func(old []byte) ([]byte, error) { return old, nil })
+	assert.Equal(t, ErrReadOnly, err)
+
+	ns, err := ro.Namespace("users")
+	assert.Nil(t, err)
+	err = ns.Put([]byte("key"), []byte("value"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ns.Delete([]byte("key"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ns.DeleteRange([]byte("a"), []byte("b"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ns.DeletePrefix([]byte("a"))
+	assert.Equal(t, ErrReadOnly, err)
+
+	wb := ro.NewWriteBatch(DefaultWriteBatchOptions)
+	err = wb.Delete(utils.GetTestKey(2))
+	assert.Equal(t, ErrReadOnly, err)
+	err = wb.Commit()
+	assert.Equal(t, ErrReadOnly, err)
+
+	var buf bytes.Buffer
+	err = db.Export(&buf)
+	assert.Nil(t, err)
+	err = ro.Import(bytes.NewReader(buf.Bytes()))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.ImportJSONLines(bytes.NewReader(nil))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.Checkpoint(filepath.Join(dir, "checkpoint"))
+	assert.Equal(t, ErrReadOnly, err)
+	err = ro.MigrateIndex(ART)
+	assert.Equal(t, ErrReadOnly, err)
+}
+
+func TestDB_ReadOnly_NoReaderLockFile(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly-nolock")
+	opts.DirPath = dir
+	db, err := OpenDB(opts)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1), []byte("value"))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// 写进程打开时创建了共享锁文件
+	readerLockPath := filepath.Join(dir, readerLockName)
+	_, err = os.Stat(readerLockPath)
+	assert.Nil(t, err)
+
+	// 旧版本或备份得到的数据目录中没有共享锁文件，只读打开时不创建
+	err = os.Remove(readerLockPath)
+	assert.Nil(t, err)
+	roOpts := opts
+	roOpts.ReadOnly = true
+	ro, err := OpenDB(roOpts)
+	assert.Nil(t, err)
+	val, err := ro.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), val)
+	err = ro.Close()
+	assert.Nil(t, err)
+	_, err = os.Stat(readerLockPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+// 列出目录之前执行回调，模拟写进程在两次读取之间追加数据
+type readDirHookFS struct {
+	fio.FS
+	onReadDir func()
+}
+
+func (h *readDirHookFS) ReadDir(dir string) ([]os.DirEntry, error) {
+	if h.onReadDir != nil {
+		onReadDir := h.onReadDir
+		h.onReadDir = nil
+		onReadDir()
+	}
+	return h.FS.ReadDir(dir)
+}
+
+func TestDB_ReadOnly_RefreshRotateRace(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-readonly-rotate")
+	opts.DirPath = dir
+	opts.DataFileSize = 64 * 1024
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+	err = db.Put(utils.GetTestKey(0), utils.RandomValue(128))
+	assert.Nil(t, err)
+
+	hookFS := &readDirHookFS{FS: fio.OSFS{}}
+	roOpts := opts
+	roOpts.ReadOnly = true
+	roOpts.FS = hookFS
+	ro, err := OpenDB(roOpts)
+	assert.Nil(t, err)
+	defer ro.Close()
+
+	// 只读实例读完活跃文件的尾部之后，写进程继续向旧的活跃文件追加记录并切换活跃文件
+	count := 1
+	hookFS.onReadDir = func() {
+		fid := db.activeFile.FileID
+		for db.activeFile.FileID == fid {
+			err := db.Put(utils.GetTestKey(count), utils.RandomValue(128))
+			assert.Nil(t, err)
+			count++
+		}
+	}
+	err = ro.Refresh()
+	assert.Nil(t, err)
+	assert.True(t, count > 2)
+	assert.Equal(t, count, len(ro.ListKeys()))
+	for i := 0; i < count; i++ {
+		_, err := ro.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+}
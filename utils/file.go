@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 )
 
 // 获取一个目录的大小
@@ -26,21 +25,6 @@ func DirSize(dirPath string) (int64, error) {
 	return size, err
 }
 
-// 获取磁盘剩余可用空间大小
-func AvailableDiskSize() (uint64, error) {
-	wd, err := syscall.Getwd()
-	if err != nil {
-		return 0, err
-	}
-
-	var stat syscall.Statfs_t
-	if err := syscall.Statfs(wd, &stat); err != nil {
-		return 0, err
-	}
-
-	return stat.Bavail * uint64(stat.Bsize), nil
-}
-
 // 数据备份——拷贝数据目录
 func CopyDir(src, dst string, exclude []string) error {
 	// 如果目标文件夹不存在，创建对应目录
@@ -0,0 +1,20 @@
+//go:build linux || darwin || freebsd
+
+package utils
+
+import "syscall"
+
+// 获取磁盘剩余可用空间大小
+func AvailableDiskSize() (uint64, error) {
+	wd, err := syscall.Getwd()
+	if err != nil {
+		return 0, err
+	}
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(wd, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package utils
+
+import "errors"
+
+// 获取磁盘剩余可用空间大小，仅支持linux、darwin和freebsd
+func AvailableDiskSize() (uint64, error) {
+	return 0, errors.New("available disk size is only supported on linux, darwin and freebsd")
+}
@@ -0,0 +1,92 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"context"
+	"io"
+	"sort"
+)
+
+// 数据校验发现的损坏位置
+type Corruption struct {
+	Fid    uint32
+	Offset int64 // 损坏的记录在数据文件中的偏移量
+	Err    error // data.ErrInvalidCRC或data.ErrInvalidFileChecksum
+}
+
+// 校验所有数据文件的完整性：逐条校验记录的校验值，封存的文件还要校验尾部记录中整个文件的校验值
+// 每读取一条记录只短暂持有读锁，不阻塞读写，可以在后台协程中执行；活跃文件只校验调用时已经写入的记录
+// 结果在Stat的Corruptions中返回，发现损坏时返回ErrDataCorrupted，ctx取消时停止校验并返回ctx.Err()
+func (db *DB) Verify(ctx context.Context) error {
+	if err := db.rlockCtx(ctx); err != nil {
+		return err
+	}
+	var fileIds []uint32
+	for fid := range db.olderFiles {
+		fileIds = append(fileIds, fid)
+	}
+	if db.activeFile != nil {
+		fileIds = append(fileIds, db.activeFile.FileID)
+	}
+	db.mu.RUnlock()
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+
+	var corruptions []Corruption
+	for _, fid := range fileIds {
+		corruption, err := db.verifyDataFile(ctx, fid)
+		if err != nil {
+			return err
+		}
+		if corruption != nil {
+			corruptions = append(corruptions, *corruption)
+		}
+	}
+
+	db.mu.Lock()
+	db.corruptions = corruptions
+	db.mu.Unlock()
+
+	if len(corruptions) > 0 {
+		return ErrDataCorrupted
+	}
+	return nil
+}
+
+// 校验一个数据文件，返回第一处损坏；损坏之后的记录位置不可信，不再继续校验
+func (db *DB) verifyDataFile(ctx context.Context, fid uint32) (*Corruption, error) {
+	var verifier *data.FileVerifier
+	for {
+		if err := db.rlockCtx(ctx); err != nil {
+			return nil, err
+		}
+
+		dataFile := db.olderFiles[fid]
+		if dataFile == nil && db.activeFile != nil && db.activeFile.FileID == fid {
+			dataFile = db.activeFile
+		}
+		// 校验期间文件已经不存在
+		if dataFile == nil {
+			db.mu.RUnlock()
+			return nil, nil
+		}
+		if verifier == nil {
+			verifier = dataFile.NewVerifier(db.opt.Checksum)
+		}
+
+		var err error = io.EOF
+		if dataFile != db.activeFile || verifier.Offset < dataFile.WriteOff {
+			err = verifier.Next()
+		}
+		db.mu.RUnlock()
+
+		switch err {
+		case nil:
+		case io.EOF:
+			return nil, nil
+		case data.ErrInvalidCRC, data.ErrInvalidFileChecksum:
+			return &Corruption{Fid: fid, Offset: verifier.Offset, Err: err}, nil
+		default:
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package bitcask
+
+import (
+	"bitcask/data"
+	"bitcask/utils"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Verify(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-verify"
+	opts.DataFileSize = 16 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.InMemory = true
+	opts.Checksum = data.ChecksumXXH3
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 500; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > 0)
+	err = db.Verify(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, db.Stat().Corruptions)
+
+	// 更换校验算法之后，已有的记录和文件仍按原来的算法校验
+	err = db.Close()
+	assert.Nil(t, err)
+	opts.FS = db.opt.FS
+	opts.Checksum = data.ChecksumCRC32C
+	db, err = OpenDB(opts)
+	assert.Nil(t, err)
+	for i := 500; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 1000; i += 100 {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = db.Verify(context.Background())
+	assert.Nil(t, err)
+
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Verify(context.Background())
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = db.Verify(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	// 修改旧的数据文件中的一个字节
+	fileName := data.GetFileName(opts.DirPath, 0)
+	buf, err := opts.FS.ReadFile(fileName)
+	assert.Nil(t, err)
+	buf[100] ^= 0xff
+	err = opts.FS.WriteFile(fileName, buf)
+	assert.Nil(t, err)
+
+	err = db.Verify(context.Background())
+	assert.Equal(t, ErrDataCorrupted, err)
+	corruptions := db.Stat().Corruptions
+	assert.Equal(t, 1, len(corruptions))
+	assert.Equal(t, uint32(0), corruptions[0].Fid)
+	assert.Equal(t, data.ErrInvalidCRC, corruptions[0].Err)
+	assert.True(t, corruptions[0].Offset <= 100)
+}
+
+func TestDB_Get_PositionMismatch(t *testing.T) {
+	opts := DefaultOptions
+	opts.DirPath = "/bitcask-go-position"
+	opts.InMemory = true
+	db, err := OpenDB(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(20))
+	assert.Nil(t, err)
+
+	// 索引指向了另一条大小不同的记录
+	pos := *db.index.Get(utils.GetTestKey(2))
+	pos.Size = db.index.Get(utils.GetTestKey(1)).Size
+	db.index.Put(utils.GetTestKey(1), &pos)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, data.ErrPositionMismatch, err)
+
+	opts.DirPath = "/bitcask-go-checksum"
+	opts.Checksum = data.ChecksumXXH3 + 1
+	_, err = OpenDB(opts)
+	assert.NotNil(t, err)
+}